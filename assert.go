@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/tidwall/gjson"
+)
+
+// assertOps is ordered so that two character operators match first
+var assertOps = []string{"==", "!=", ">=", "<=", "~=", "*=", ">", "<"}
+
+// assertFailures counts failed assertions, it decides the exit status of
+// non-interactive runs
+var assertFailures int
+
+// Assertion checks the response, written as ?<target><op><value>
+//
+//	?status==200          status code
+//	?time<500             response time in ms
+//	?header.Content-Type  header presence, or compared with an op
+//	?#data.id==3          gjson path of the response body
+//	?body*=ok             body contains, ~= matches a regexp
+type Assertion struct {
+	Target string
+	Op     string
+	Value  string
+}
+
+func parseAssert(expr string) (*Assertion, error) {
+	a := &Assertion{Target: expr}
+	// gjson queries may contain operators themselves, so split them at the
+	// last operator and everything else at the first one
+	last := strings.HasPrefix(expr, "#")
+	idx := -1
+	for _, op := range assertOps {
+		i := strings.Index(expr, op)
+		if last {
+			i = strings.LastIndex(expr, op)
+		}
+		if i <= 0 {
+			continue
+		}
+		if idx < 0 || !last && i < idx || last && i > idx {
+			idx = i
+			a.Target, a.Op, a.Value = expr[:i], op, expr[i+len(op):]
+		}
+	}
+
+	switch {
+	case a.Target == "status", a.Target == "time":
+		if a.Op == "" {
+			return nil, fmt.Errorf("?%s needs an operator, eg: ?status==200", a.Target)
+		}
+	case a.Target == "body":
+		if a.Op == "" {
+			return nil, fmt.Errorf("?body needs an operator, eg: ?body*=ok")
+		}
+	case strings.HasPrefix(a.Target, "header.") && len(a.Target) > len("header."):
+	case strings.HasPrefix(a.Target, "#") && len(a.Target) > 1:
+	default:
+		return nil, fmt.Errorf("unknown assertion `?%s`", expr)
+	}
+	if a.Op == "~=" {
+		if _, err := regexp.Compile(a.Value); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+func (a *Assertion) String() string {
+	return "?" + a.Target + a.Op + a.Value
+}
+
+// check evaluates the assertion against the response of r, it returns
+// the actual value and whether the assertion holds
+func (a *Assertion) check(r *Request) (string, bool) {
+	var actual string
+	var exists = true
+	switch {
+	case a.Target == "status":
+		actual = strconv.Itoa(r.ResponseStatus)
+	case a.Target == "time":
+		actual = strconv.FormatInt(r.ResponseTime.Milliseconds(), 10)
+	case a.Target == "body":
+		actual = string(r.ResponseBody)
+	case strings.HasPrefix(a.Target, "header."):
+		name := a.Target[len("header."):]
+		_, exists = r.ResponseHeader[http.CanonicalHeaderKey(name)]
+		actual = r.ResponseHeader.Get(name)
+	case strings.HasPrefix(a.Target, "#"):
+		v := gjson.GetBytes(r.ResponseBody, a.Target[1:])
+		exists = v.Exists()
+		actual = v.String()
+	}
+	if a.Op == "" {
+		return actual, exists
+	}
+	return actual, exists && compare(actual, a.Op, a.Value)
+}
+
+func compare(actual, op, expected string) bool {
+	switch op {
+	case "~=":
+		ok, _ := regexp.MatchString(expected, actual)
+		return ok
+	case "*=":
+		return strings.Contains(actual, expected)
+	}
+	x, err1 := strconv.ParseFloat(actual, 64)
+	y, err2 := strconv.ParseFloat(expected, 64)
+	if err1 == nil && err2 == nil {
+		switch op {
+		case "==":
+			return x == y
+		case "!=":
+			return x != y
+		case ">":
+			return x > y
+		case ">=":
+			return x >= y
+		case "<":
+			return x < y
+		case "<=":
+			return x <= y
+		}
+	}
+	switch op {
+	case "==":
+		return actual == expected
+	case "!=":
+		return actual != expected
+	case ">":
+		return actual > expected
+	case ">=":
+		return actual >= expected
+	case "<":
+		return actual < expected
+	case "<=":
+		return actual <= expected
+	}
+	return false
+}
+
+func (r *Request) addAssert(expr string) {
+	for _, a := range r.Asserts {
+		if a == expr {
+			return
+		}
+	}
+	r.Asserts = append(r.Asserts, expr)
+}
+
+// checkAsserts prints a pass/fail line for each assertion of r and
+// reports whether all of them passed
+func checkAsserts(r *Request) bool {
+	pass := color.New(color.FgGreen)
+	fail := color.New(color.FgHiRed)
+	ok := true
+	for _, expr := range r.Asserts {
+		a, err := parseAssert(expand(expr))
+		if err != nil {
+			fail.Println("  ✗", "?"+expr, err)
+			ok = false
+			continue
+		}
+		actual, passed := a.check(r)
+		if passed {
+			pass.Println("  ✓", a)
+			continue
+		}
+		ok = false
+		if len(actual) > 80 {
+			actual = actual[:80] + "..."
+		}
+		fail.Printf("  ✗ %s, actual `%s`\n", a, actual)
+	}
+	if !ok {
+		assertFailures++
+	}
+	return ok
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseAssert(t *testing.T) {
+	cases := map[string][3]string{
+		"status==200":               {"status", "==", "200"},
+		"time<=500":                 {"time", "<=", "500"},
+		"header.X-Id":               {"header.X-Id", "", ""},
+		"body~=^ok$":                {"body", "~=", "^ok$"},
+		`#items.#(name=="a").id>=3`: {`#items.#(name=="a").id`, ">=", "3"},
+	}
+	for expr, expected := range cases {
+		a, err := parseAssert(expr)
+		if err != nil {
+			t.Errorf("%s: %v", expr, err)
+			continue
+		}
+		if actual := [3]string{a.Target, a.Op, a.Value}; actual != expected {
+			t.Errorf("expected %q, actual %q", expected, actual)
+		}
+	}
+	if _, err := parseAssert("status"); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestCheckAssert(t *testing.T) {
+	r := newReq()
+	r.ResponseStatus = 201
+	r.ResponseTime = 120 * time.Millisecond
+	r.ResponseHeader = http.Header{"X-Id": {"7"}}
+	r.ResponseBody = []byte(`{"data":{"id":3,"name":"httpgo"}}`)
+
+	cases := map[string]bool{
+		"status>=200":         true,
+		"status==200":         false,
+		"time<100":            false,
+		"header.x-id==7":      true,
+		"header.X-Missing":    false,
+		"#data.id==3":         true,
+		"#data.name~=^http":   true,
+		"#data.missing!=3":    false,
+		"body*=httpgo":        true,
+		"#data.name!=another": true,
+	}
+	for expr, expected := range cases {
+		a, err := parseAssert(expr)
+		if err != nil {
+			t.Errorf("%s: %v", expr, err)
+			continue
+		}
+		if _, ok := a.check(r); ok != expected {
+			t.Errorf("%s expected %v, actual %v", expr, expected, ok)
+		}
+	}
+}
@@ -0,0 +1,779 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/bits"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// histSub is the number of sub buckets per power of two, latencies are
+// recorded in microseconds with a relative error below 1/histSub
+const histSub = 64
+
+// histogram is a log-linear latency histogram of fixed memory
+type histogram struct {
+	counts []uint64
+	n      uint64
+	sum    time.Duration
+	min    time.Duration
+	max    time.Duration
+}
+
+func newHistogram() *histogram {
+	return &histogram{counts: make([]uint64, 2*histSub+64*histSub)}
+}
+
+func bucketOf(us uint64) int {
+	if us < 2*histSub {
+		return int(us)
+	}
+	e := bits.Len64(us) - 7
+	return 2*histSub + (e-1)*histSub + int(us>>uint(e)) - histSub
+}
+
+// bucketValue is the middle of bucket idx in microseconds
+func bucketValue(idx int) uint64 {
+	if idx < 2*histSub {
+		return uint64(idx)
+	}
+	k := idx - 2*histSub
+	e := uint(k/histSub + 1)
+	m := uint64(k%histSub + histSub)
+	return m<<e + (1<<e)/2
+}
+
+func (h *histogram) record(d time.Duration) {
+	us := uint64(d / time.Microsecond)
+	idx := bucketOf(us)
+	if idx >= len(h.counts) {
+		idx = len(h.counts) - 1
+	}
+	h.counts[idx]++
+	if h.n == 0 || d < h.min {
+		h.min = d
+	}
+	if d > h.max {
+		h.max = d
+	}
+	h.n++
+	h.sum += d
+}
+
+func (h *histogram) mean() time.Duration {
+	if h.n == 0 {
+		return 0
+	}
+	return h.sum / time.Duration(h.n)
+}
+
+// percentile returns the latency below which p percent of requests fall
+func (h *histogram) percentile(p float64) time.Duration {
+	if h.n == 0 {
+		return 0
+	}
+	target := uint64(float64(h.n)*p/100 + 0.5)
+	if target == 0 {
+		target = 1
+	}
+	var cum uint64
+	for i, c := range h.counts {
+		cum += c
+		if cum >= target {
+			d := time.Duration(bucketValue(i)) * time.Microsecond
+			if d > h.max {
+				d = h.max
+			}
+			if d < h.min {
+				d = h.min
+			}
+			return d
+		}
+	}
+	return h.max
+}
+
+// benchResult collects the outcome of every request of a bench run
+type benchResult struct {
+	// InFlight is updated atomically, first for 64-bit alignment
+	InFlight int64
+	mu       sync.Mutex
+	Start    time.Time
+	Elapsed  time.Duration
+	Total    uint64
+	Success  uint64
+	Failed   uint64
+	Bytes    int64
+	Status   map[int]uint64
+	Protos   map[string]uint64
+	Errors   map[string]uint64
+	Latency  *histogram
+	// window is the latency of the last second for live progress
+	window *histogram
+	// Phases are the latencies of phaseNames, Conns counts new connections
+	Phases []*histogram
+	Conns  uint64
+	// rate mode, Sending is the time taken to start all requests
+	Target  float64
+	Sending time.Duration
+	MaxLag  time.Duration
+}
+
+func newBenchResult() *benchResult {
+	return &benchResult{Start: time.Now(), Status: make(map[int]uint64), Protos: make(map[string]uint64), Errors: make(map[string]uint64), Latency: newHistogram()}
+}
+
+// errorKind is err without the URL and the addresses, which differ from
+// one request of a bench to the other
+func errorKind(err error) string {
+	if e, ok := err.(*url.Error); ok {
+		err = e.Err
+	}
+	var op *net.OpError
+	if errors.As(err, &op) {
+		return op.Op + ": " + op.Err.Error()
+	}
+	return err.Error()
+}
+
+func (b *benchResult) record(d time.Duration, status int, proto string, n int64, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.Total++
+	b.Bytes += n
+	if err != nil {
+		b.Failed++
+		b.Errors[errorKind(err)]++
+		return
+	}
+	b.Latency.record(d)
+	if b.window != nil {
+		b.window.record(d)
+	}
+	b.Status[status]++
+	b.Protos[proto]++
+	if status < 400 {
+		b.Success++
+	} else {
+		b.Failed++
+	}
+}
+
+func (b *benchResult) recordPhases(tm *Timing) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.Phases == nil {
+		b.Phases = make([]*histogram, len(phaseNames))
+		for i := range b.Phases {
+			b.Phases[i] = newHistogram()
+		}
+	}
+	for i, d := range tm.phases() {
+		if d > 0 {
+			b.Phases[i].record(d)
+		}
+	}
+	if !tm.Reused {
+		b.Conns++
+	}
+}
+
+func (b *benchResult) rps() float64 {
+	if b.Elapsed <= 0 {
+		return 0
+	}
+	return float64(b.Total) / b.Elapsed.Seconds()
+}
+
+func (b *benchResult) report() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	bold := color.New(color.Bold)
+	bold.Println("\nSummary:")
+	fmt.Printf("  Total:        %d\n", b.Total)
+	fmt.Printf("  Successful:   %d\n", b.Success)
+	fmt.Printf("  Failed:       %d\n", b.Failed)
+	fmt.Printf("  Elapsed:      %v\n", b.Elapsed.Round(time.Millisecond))
+	fmt.Printf("  Requests/sec: %.2f\n", b.rps())
+	fmt.Printf("  Transferred:  %s\n", formatBytes(b.Bytes))
+	if len(b.Protos) > 0 {
+		protos := make([]string, 0, len(b.Protos))
+		for p := range b.Protos {
+			protos = append(protos, p)
+		}
+		sort.Strings(protos)
+		fmt.Printf("  Protocol:     %s\n", strings.Join(protos, ", "))
+	}
+	if b.Target > 0 && b.Sending > 0 {
+		actual := float64(b.Total) / b.Sending.Seconds()
+		c := color.New(color.FgGreen)
+		if actual < b.Target*0.95 {
+			c = color.New(color.FgHiRed)
+		}
+		fmt.Printf("  Target rate:  %.2f/sec\n", b.Target)
+		c.Printf("  Actual rate:  %.2f/sec (%.1f%% of target)\n", actual, actual/b.Target*100)
+		fmt.Printf("  Max lag:      %v behind schedule\n", round(b.MaxLag))
+	}
+
+	h := b.Latency
+	bold.Println("\nLatency:")
+	fmt.Printf("  Min:  %v\n", round(h.min))
+	fmt.Printf("  Mean: %v\n", round(h.mean()))
+	for _, p := range []float64{50, 90, 95, 99} {
+		fmt.Printf("  P%v:  %v\n", p, round(h.percentile(p)))
+	}
+	fmt.Printf("  Max:  %v\n", round(h.max))
+	h.draw()
+
+	if b.Phases != nil {
+		bold.Println("\nPhases:")
+		fmt.Printf("  %-17s %8s %10s %10s %10s\n", "", "Count", "Mean", "P50", "P99")
+		for i, p := range b.Phases {
+			fmt.Printf("  %-17s %8d %10v %10v %10v\n", phaseNames[i], p.n, round(p.mean()), round(p.percentile(50)), round(p.percentile(99)))
+		}
+		fmt.Printf("  New connections:  %d\n", b.Conns)
+	}
+
+	if len(b.Status) > 0 {
+		bold.Println("\nStatus codes:")
+		codes := make([]int, 0, len(b.Status))
+		for code := range b.Status {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		for _, code := range codes {
+			fmt.Printf("  [%d] %d responses\n", code, b.Status[code])
+		}
+	}
+	if len(b.Errors) > 0 {
+		bold.Println("\nErrors:")
+		errs := make([]string, 0, len(b.Errors))
+		for e := range b.Errors {
+			errs = append(errs, e)
+		}
+		sort.Slice(errs, func(i, j int) bool { return b.Errors[errs[i]] > b.Errors[errs[j]] })
+		for _, e := range errs {
+			fmt.Printf("  [%d] %s\n", b.Errors[e], e)
+		}
+	}
+	fmt.Println("")
+}
+
+// draw prints the latency distribution as a bar chart of ten ranges
+func (h *histogram) draw() {
+	if h.n == 0 {
+		return
+	}
+	const rows, width = 10, 40
+	lo, hi := h.min, h.max
+	step := (hi - lo) / rows
+	if step <= 0 {
+		step = 1
+	}
+	var counts [rows]uint64
+	var most uint64
+	for i, c := range h.counts {
+		if c == 0 {
+			continue
+		}
+		row := int((time.Duration(bucketValue(i))*time.Microsecond - lo) / step)
+		if row < 0 {
+			row = 0
+		} else if row >= rows {
+			row = rows - 1
+		}
+		counts[row] += c
+		if counts[row] > most {
+			most = counts[row]
+		}
+	}
+	fmt.Println("\nHistogram:")
+	for i, c := range counts {
+		bar := int(c * width / most)
+		fmt.Printf("  %10v [%8d] |%s\n", round(lo+time.Duration(i+1)*step), c, strings.Repeat("■", bar))
+	}
+}
+
+func round(d time.Duration) time.Duration {
+	switch {
+	case d > time.Second:
+		return d.Round(time.Millisecond)
+	case d > time.Millisecond:
+		return d.Round(time.Microsecond * 10)
+	}
+	return d.Round(time.Microsecond)
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for x := n / unit; x >= unit; x /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.2f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+var (
+	benchMu     sync.Mutex
+	benchCancel context.CancelFunc
+)
+
+// cancelBench stops the running bench, it reports whether one was running
+func cancelBench() bool {
+	benchMu.Lock()
+	defer benchMu.Unlock()
+	if benchCancel == nil {
+		return false
+	}
+	benchCancel()
+	return true
+}
+
+// benchRequest returns a copy of req for a bench, the prompt keeps
+// changing req while a bench runs in the background. The {{name}}
+// variables are resolved here once, the iterations of the bench only
+// expand the {{$...}} generators and never read the variables the prompt
+// sets meanwhile.
+func benchRequest() (*Request, error) {
+	var unset string
+	d := req.data().expandWith(func(s string) string {
+		s = expand(s)
+		for _, m := range regPlaceholder.FindAllStringSubmatch(s, -1) {
+			if !strings.HasPrefix(m[1], "$") && unset == "" {
+				unset = m[0]
+			}
+		}
+		return s
+	})
+	if unset != "" {
+		return nil, fmt.Errorf("%s is not set", unset)
+	}
+	b, err := d.request()
+	if err != nil {
+		return nil, err
+	}
+	b.TLS.PKCS12Password = expand(b.TLS.PKCS12Password)
+	b.Bench = true
+	b.NumberOfRequest = req.NumberOfRequest
+	b.Concurrency = req.Concurrency
+	b.Rate = req.Rate
+	b.Stages = append([]benchStage(nil), req.Stages...)
+	// $run=name names the next run only, later runs would overwrite it
+	b.RunName, req.RunName = req.RunName, ""
+	b.Duration = req.Duration
+	if b.Concurrency == 0 {
+		b.Concurrency = 1
+	}
+	return b, nil
+}
+
+// bench runs the benchmark described by b, a copy from benchRequest, until
+// it completes or is cancelled by Ctrl+C, the report covers the requests
+// done so far
+func bench(b *Request) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	benchMu.Lock()
+	if benchCancel != nil {
+		benchMu.Unlock()
+		fmt.Println("> Bench is running, Ctrl+C to cancel")
+		return fmt.Errorf("bench is running")
+	}
+	benchCancel = cancel
+	benchMu.Unlock()
+	defer func() {
+		benchMu.Lock()
+		benchCancel = nil
+		benchMu.Unlock()
+	}()
+	// the terminal is not raw in one-shot mode, Ctrl+C sends SIGINT
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	defer signal.Stop(sig)
+	go func() {
+		select {
+		case <-sig:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	client, err := newClient(b)
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return err
+	}
+	// the request is rebuilt for every iteration so that bodies are fresh
+	// and {{$...}} generators get new values
+	data := b.data()
+	// check the generators once without taking a $seq, sending or
+	// authorizing anything
+	data.expandWith(func(s string) string {
+		if _, e := gen.expand(s, 0); e != nil && err == nil {
+			err = e
+		}
+		return s
+	})
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return err
+	}
+	res := newBenchResult()
+
+	// send records the latency from start, which is the intended start
+	// time in rate mode, into each result
+	var send = func(start time.Time, results ...*benchResult) {
+		var (
+			status int
+			proto  string
+			n      int64
+			resp   *http.Response
+		)
+		atomic.AddInt64(&res.InFlight, 1)
+		defer atomic.AddInt64(&res.InFlight, -1)
+		r, err := buildRequest(data, gen.next(), false)
+		var t *tracer
+		if err == nil {
+			var tctx context.Context
+			t, tctx = newTracer(ctx)
+			resp, err = client.Do(r.WithContext(tctx))
+		}
+		if err == nil && resp.StatusCode == http.StatusUnauthorized && b.AuthType == "digest" && digestChallenged(r, resp) {
+			// the first request of a run or a stale nonce, answer the challenge,
+			// workers share the nonce count, see digestSession
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+			if r, err = buildRequest(data, gen.next(), false); err == nil {
+				var tctx context.Context
+				t, tctx = newTracer(ctx)
+				resp, err = client.Do(r.WithContext(tctx))
+			}
+		}
+		if err == nil {
+			n, err = io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+			status, proto = resp.StatusCode, resp.Proto
+			t.finish()
+			if status == http.StatusUnauthorized && b.OAuth != "" {
+				invalidateOAuth(b.OAuth, r.Header.Get("Authorization"))
+			}
+			res.recordPhases(t.timing())
+		}
+		if err != nil && ctx.Err() != nil {
+			// aborted by cancel
+			return
+		}
+		d := time.Since(start)
+		for _, res := range results {
+			res.record(d, status, proto, n, err)
+		}
+	}
+
+	if len(b.Stages) > 0 {
+		fmt.Printf("> Bench %s %s in %d stages\n", data.Method, data.URL, len(b.Stages))
+	} else if b.Rate > 0 {
+		fmt.Printf("> Bench %s %s at %.2f requests/sec for %v\n", data.Method, data.URL, b.Rate, b.Duration)
+	} else {
+		fmt.Printf("> Bench %s %s with %d workers\n", data.Method, data.URL, b.Concurrency)
+	}
+	var done chan struct{}
+	pctx, stop := context.WithCancel(ctx)
+	if fi, err := os.Stdout.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		res.window = newHistogram()
+		done = make(chan struct{})
+		go func() {
+			res.progress(pctx)
+			close(done)
+		}()
+	}
+
+	var stages []*benchResult
+	if len(b.Stages) > 0 {
+		stages = benchStages(ctx, b, res, send)
+	} else if b.Rate > 0 {
+		benchRate(ctx, b, res, send)
+	} else {
+		benchWorkers(ctx, b, res, send)
+	}
+	res.Elapsed = time.Since(res.Start)
+	cancelled := ctx.Err() != nil
+	stop()
+	if done != nil {
+		<-done
+	}
+
+	if cancelled {
+		color.Yellow("> Bench cancelled after %v, partial results\n", res.Elapsed.Round(time.Millisecond))
+	}
+	if len(stages) > 0 {
+		reportStages(b.Stages, stages)
+	}
+	res.report()
+
+	// the jar of the client, the environment may have changed meanwhile
+	client.Jar.(*cookieJar).save()
+
+	run := newBenchRun(b, data, res)
+	run.Cancelled = cancelled
+	if err := run.save(); err != nil {
+		fmt.Println("Save run", run.Name, err)
+	} else {
+		fmt.Printf("> Saved run `%s`\n", run.Name)
+	}
+	return nil
+}
+
+// progress prints a status line every second until ctx is done, p50 and
+// p99 are of the responses of the last second
+func (b *benchResult) progress(ctx context.Context) {
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+	var last uint64
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Print("\r\033[K")
+			return
+		case <-tick.C:
+		}
+		b.mu.Lock()
+		total, failed, window := b.Total, b.Failed, b.window
+		b.window = newHistogram()
+		b.mu.Unlock()
+		fmt.Printf("\r\033[K  %v  done %d  in-flight %d  %d/s  p50 %v  p99 %v  failed %d",
+			time.Since(b.Start).Round(time.Second), total, atomic.LoadInt64(&b.InFlight), total-last,
+			round(window.percentile(50)), round(window.percentile(99)), failed)
+		last = total
+	}
+}
+
+// benchWorkers runs Concurrency workers until NumberOfRequest requests
+// were sent or Duration elapsed
+func benchWorkers(ctx context.Context, b *Request, res *benchResult, send func(time.Time, ...*benchResult)) {
+	c := make(chan struct{}, b.Concurrency)
+	var wg sync.WaitGroup
+
+	var do = func() {
+		defer func() {
+			<-c
+			wg.Done()
+		}()
+		send(time.Now(), res)
+	}
+
+	// requests in flight when Duration elapses are waited for, only
+	// cancel aborts them
+	until := ctx
+	if int64(b.Duration) != 0 {
+		var cancel context.CancelFunc
+		until, cancel = context.WithTimeout(ctx, b.Duration)
+		defer cancel()
+	}
+	n := b.NumberOfRequest
+	if n == 0 {
+		n = 1
+	}
+bench:
+	for i := uint64(0); b.Duration != 0 || i < n; i++ {
+		select {
+		case <-until.Done():
+			break bench
+		case c <- struct{}{}:
+			wg.Add(1)
+			go do()
+		}
+	}
+	wg.Wait()
+}
+
+// maxInFlight bounds the requests of rate mode when $bench sets no limit
+const maxInFlight = 10000
+
+// maxConns is the most requests b has in flight, the size of the idle
+// connection pool so connections are reused
+func (b *Request) maxConns() int {
+	if len(b.Stages) > 0 {
+		n := 1
+		for _, st := range b.Stages {
+			if st.Target > n {
+				n = st.Target
+			}
+		}
+		return n
+	}
+	if b.Rate > 0 && b.Concurrency <= 1 {
+		return maxInFlight
+	}
+	return int(b.Concurrency)
+}
+
+// benchRate starts Rate requests per second for Duration regardless of
+// response times. Latency is measured from the intended start so slow
+// responses are not hidden by a delayed schedule (coordinated omission).
+func benchRate(ctx context.Context, b *Request, res *benchResult, send func(time.Time, ...*benchResult)) {
+	c := make(chan struct{}, b.maxConns())
+	var wg sync.WaitGroup
+
+	interval := time.Duration(float64(time.Second) / b.Rate)
+	total := int(b.Duration.Seconds() * b.Rate)
+	res.Target = b.Rate
+	start := time.Now()
+bench:
+	for i := 0; i < total; i++ {
+		intended := start.Add(time.Duration(i) * interval)
+		if d := time.Until(intended); d > 0 {
+			select {
+			case <-time.After(d):
+			case <-ctx.Done():
+				break bench
+			}
+		}
+		select {
+		case c <- struct{}{}:
+		case <-ctx.Done():
+			break bench
+		}
+		if lag := time.Since(intended); lag > res.MaxLag {
+			res.MaxLag = lag
+		}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-c
+				wg.Done()
+			}()
+			send(intended, res)
+		}()
+	}
+	res.Sending = time.Since(start)
+	if res.Sending < b.Duration && ctx.Err() == nil {
+		res.Sending = b.Duration
+	}
+	wg.Wait()
+}
+
+// benchStage ramps the number of workers linearly from the target of the
+// previous stage to Target over Duration
+type benchStage struct {
+	Duration time.Duration `json:"duration"`
+	Target   int           `json:"target"`
+}
+
+// parseStages parses {duration}:{workers},... eg: 30s:50,2m:50,1m:200,30s:0
+func parseStages(value string) ([]benchStage, error) {
+	var stages []benchStage
+	for _, s := range strings.Split(value, ",") {
+		pair := strings.SplitN(s, ":", 2)
+		if len(pair) != 2 {
+			return nil, fmt.Errorf("invalid stage `%s`, eg: 30s:50", s)
+		}
+		d, err := time.ParseDuration(pair[0])
+		if err != nil {
+			return nil, err
+		}
+		n, err := strconv.Atoi(pair[1])
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid workers `%s`", pair[1])
+		}
+		stages = append(stages, benchStage{Duration: d, Target: n})
+	}
+	return stages, nil
+}
+
+// benchStages scales the workers through b.Stages, every request is
+// recorded into res and into the result of the stage it started in
+func benchStages(ctx context.Context, b *Request, res *benchResult, send func(time.Time, ...*benchResult)) []*benchResult {
+	var (
+		mu      sync.Mutex
+		stage   *benchResult
+		workers []context.CancelFunc
+		wg      sync.WaitGroup
+	)
+	var current = func() *benchResult {
+		mu.Lock()
+		defer mu.Unlock()
+		return stage
+	}
+	var scale = func(n int) {
+		for len(workers) < n {
+			ctx, cancel := context.WithCancel(ctx)
+			workers = append(workers, cancel)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for ctx.Err() == nil {
+					send(time.Now(), res, current())
+				}
+			}()
+		}
+		for len(workers) > n {
+			workers[len(workers)-1]()
+			workers = workers[:len(workers)-1]
+		}
+	}
+
+	var results []*benchResult
+	var from int
+	tick := time.NewTicker(100 * time.Millisecond)
+	defer tick.Stop()
+stages:
+	for _, st := range b.Stages {
+		sr := newBenchResult()
+		mu.Lock()
+		stage = sr
+		mu.Unlock()
+		results = append(results, sr)
+		for el := time.Duration(0); el < st.Duration; el = time.Since(sr.Start) {
+			scale(from + int(float64(st.Target-from)*float64(el)/float64(st.Duration)))
+			select {
+			case <-tick.C:
+			case <-ctx.Done():
+				sr.Elapsed = time.Since(sr.Start)
+				break stages
+			}
+		}
+		scale(st.Target)
+		sr.Elapsed = time.Since(sr.Start)
+		from = st.Target
+	}
+	scale(0)
+	wg.Wait()
+	return results
+}
+
+func reportStages(stages []benchStage, results []*benchResult) {
+	color.New(color.Bold).Println("\nStages:")
+	fmt.Printf("  %-3s %-20s %8s %10s %10s %10s %8s\n", "#", "Workers", "Total", "Req/sec", "P50", "P99", "Failed")
+	var from int
+	for i, res := range results {
+		res.mu.Lock()
+		st := stages[i]
+		desc := fmt.Sprintf("%d in %v", st.Target, st.Duration)
+		if st.Target != from {
+			desc = fmt.Sprintf("%d→%d in %v", from, st.Target, st.Duration)
+		}
+		fmt.Printf("  %-3d %-20s %8d %10.2f %10v %10v %8d\n", i+1, desc, res.Total, res.rps(),
+			round(res.Latency.percentile(50)), round(res.Latency.percentile(99)), res.Failed)
+		from = st.Target
+		res.mu.Unlock()
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBucket(t *testing.T) {
+	for _, us := range []uint64{0, 1, 127, 128, 129, 255, 256, 1000, 123456, 1 << 40} {
+		v := bucketValue(bucketOf(us))
+		if diff := float64(v) - float64(us); diff < 0 && -diff > float64(us)/histSub || diff > float64(us)/histSub+1 {
+			t.Errorf("%d expected within %d, actual %d", us, us/histSub, v)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	h := newHistogram()
+	for i := 1; i <= 1000; i++ {
+		h.record(time.Duration(i) * time.Millisecond)
+	}
+	cases := map[float64]time.Duration{50: 500 * time.Millisecond, 90: 900 * time.Millisecond, 99: 990 * time.Millisecond}
+	for p, expected := range cases {
+		actual := h.percentile(p)
+		if diff := actual - expected; diff < -expected/histSub || diff > expected/histSub {
+			t.Errorf("P%v expected %v, actual %v", p, expected, actual)
+		}
+	}
+	if h.min != time.Millisecond || h.max != time.Second {
+		t.Errorf("expected %v %v, actual %v %v", time.Millisecond, time.Second, h.min, h.max)
+	}
+	if h.mean() != 500500*time.Microsecond {
+		t.Errorf("expected %v, actual %v", 500500*time.Microsecond, h.mean())
+	}
+}
+
+func TestRelChange(t *testing.T) {
+	cases := []struct {
+		a, b   float64
+		change float64
+		text   string
+	}{
+		{100, 110, 0.1, "+10.0%"},
+		{200, 150, -0.25, "-25.0%"},
+		{5, 5, 0, "0.0%"},
+		{0, 1, 1, "new"},
+	}
+	for _, c := range cases {
+		change, text := relChange(c.a, c.b)
+		if math.Abs(change-c.change) > 1e-9 || text != c.text {
+			t.Errorf("expected %v %v, actual %v %v", c.change, c.text, change, text)
+		}
+	}
+}
+
+func TestMaxConns(t *testing.T) {
+	cases := []struct {
+		r        Request
+		expected int
+	}{
+		{Request{Concurrency: 8}, 8},
+		{Request{Concurrency: 1, Rate: 500}, maxInFlight},
+		{Request{Concurrency: 20, Rate: 500}, 20},
+		{Request{Concurrency: 1, Stages: []benchStage{{time.Second, 50}, {time.Second, 200}, {time.Second, 0}}}, 200},
+	}
+	for _, c := range cases {
+		if actual := c.r.maxConns(); actual != c.expected {
+			t.Errorf("expected %v, actual %v", c.expected, actual)
+		}
+	}
+}
+
+func TestBenchVariables(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		paths = make(map[string]int)
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths[r.URL.Path]++
+		mu.Unlock()
+	}))
+	defer ts.Close()
+	t.Setenv("HOME", t.TempDir())
+
+	oldReq, oldVars := req, sessionVars
+	defer func() { req, sessionVars = oldReq, oldVars }()
+	sessionVars = map[string]string{"id": "1"}
+	req = newReq()
+	parseInput("GET " + ts.URL + "/users/{{id}}")
+	req.NumberOfRequest, req.Concurrency = 50, 4
+
+	b, err := benchRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() { done <- bench(b) }()
+	// the prompt captures new values while the bench runs
+	for i := 0; ; i++ {
+		select {
+		case err = <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+			if paths["/users/1"] != 50 {
+				t.Errorf("expected %v, actual %v", map[string]int{"/users/1": 50}, paths)
+			}
+			return
+		default:
+			sessionVars["id"] = strconv.Itoa(i)
+		}
+	}
+}
+
+func TestBenchUnsetVariable(t *testing.T) {
+	oldReq := req
+	defer func() { req = oldReq }()
+	req = newReq()
+	parseInput("GET http://localhost/{{nope}}?n={{$seq}}")
+	if _, err := benchRequest(); err == nil {
+		t.Errorf("expected error, actual nil")
+	}
+}
+
+func TestErrorKind(t *testing.T) {
+	reset := &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer"),
+		Source: &net.TCPAddr{Port: 50001}, Addr: &net.TCPAddr{Port: 80}}
+	a := &url.Error{Op: "Get", URL: "http://a/users/1", Err: reset}
+	b := &url.Error{Op: "Get", URL: "http://a/users/2", Err: reset}
+	if errorKind(a) != "read: connection reset by peer" || errorKind(a) != errorKind(b) {
+		t.Errorf("expected %v, actual %v %v", "read: connection reset by peer", errorKind(a), errorKind(b))
+	}
+	timeout := &url.Error{Op: "Get", URL: "http://a/users/3", Err: errors.New("context deadline exceeded")}
+	if errorKind(timeout) != "context deadline exceeded" {
+		t.Errorf("expected %v, actual %v", "context deadline exceeded", errorKind(timeout))
+	}
+}
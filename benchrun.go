@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// regression is the relative change of a metric that is highlighted
+const regression = 0.05
+
+var latencyKeys = []string{"min", "mean", "p50", "p90", "p95", "p99", "max"}
+
+// benchRun is a saved bench result, latencies are in milliseconds
+type benchRun struct {
+	Name        string             `json:"name"`
+	Time        time.Time          `json:"time"`
+	Env         string             `json:"env,omitempty"`
+	Request     RequestData        `json:"request"`
+	Mode        string             `json:"mode"`
+	Concurrency uint64             `json:"concurrency,omitempty"`
+	Requests    uint64             `json:"requests,omitempty"`
+	Duration    time.Duration      `json:"duration,omitempty"`
+	Rate        float64            `json:"rate,omitempty"`
+	Stages      []benchStage       `json:"stages,omitempty"`
+	Total       uint64             `json:"total"`
+	Success     uint64             `json:"success"`
+	Failed      uint64             `json:"failed"`
+	Bytes       int64              `json:"bytes"`
+	Elapsed     time.Duration      `json:"elapsed"`
+	RPS         float64            `json:"rps"`
+	ErrorRate   float64            `json:"error_rate"`
+	Latency     map[string]float64 `json:"latency"`
+	Status      map[int]uint64     `json:"status,omitempty"`
+	Errors      map[string]uint64  `json:"errors,omitempty"`
+	Cancelled   bool               `json:"cancelled,omitempty"`
+}
+
+func benchDir() string {
+	dir := dataPath("bench")
+	os.MkdirAll(dir, 0700)
+	return dir
+}
+
+func newBenchRun(r *Request, data RequestData, res *benchResult) *benchRun {
+	res.mu.Lock()
+	defer res.mu.Unlock()
+	run := &benchRun{
+		Name:        r.RunName,
+		Time:        res.Start,
+		Env:         activeEnv,
+		Request:     data,
+		Mode:        "workers",
+		Concurrency: r.Concurrency,
+		Requests:    r.NumberOfRequest,
+		Duration:    r.Duration,
+		Total:       res.Total,
+		Success:     res.Success,
+		Failed:      res.Failed,
+		Bytes:       res.Bytes,
+		Elapsed:     res.Elapsed,
+		RPS:         res.rps(),
+		Latency:     make(map[string]float64),
+		Status:      res.Status,
+		Errors:      res.Errors,
+	}
+	if run.Name == "" {
+		run.Name = res.Start.Format("20060102-150405")
+	}
+	if len(r.Stages) > 0 {
+		run.Mode = "stages"
+		run.Stages = r.Stages
+		run.Requests, run.Duration = 0, 0
+	} else if r.Rate > 0 {
+		run.Mode = "rate"
+		run.Rate = r.Rate
+		run.Concurrency, run.Requests = 0, 0
+	}
+	if res.Total > 0 {
+		run.ErrorRate = float64(res.Failed) / float64(res.Total)
+	}
+	h := res.Latency
+	for _, k := range latencyKeys {
+		var d time.Duration
+		switch k {
+		case "min":
+			d = h.min
+		case "mean":
+			d = h.mean()
+		case "max":
+			d = h.max
+		default:
+			p, _ := strconv.ParseFloat(k[1:], 64)
+			d = h.percentile(p)
+		}
+		run.Latency[k] = float64(d) / float64(time.Millisecond)
+	}
+	return run
+}
+
+// save writes the run as <name>.json and <name>.csv, readable by the owner
+// only as the request may hold credentials
+func (run *benchRun) save() error {
+	b, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return err
+	}
+	base := filepath.Join(benchDir(), run.Name)
+	if err = ioutil.WriteFile(base+".json", b, 0600); err != nil {
+		return err
+	}
+
+	header := []string{"name", "time", "env", "method", "url", "mode", "concurrency", "rate", "duration", "total", "success", "failed", "error_rate", "rps", "bytes"}
+	row := []string{
+		run.Name, run.Time.Format(time.RFC3339), run.Env, run.Request.Method, run.Request.URL, run.Mode,
+		strconv.FormatUint(run.Concurrency, 10), strconv.FormatFloat(run.Rate, 'f', 2, 64), run.Duration.String(),
+		strconv.FormatUint(run.Total, 10), strconv.FormatUint(run.Success, 10), strconv.FormatUint(run.Failed, 10),
+		strconv.FormatFloat(run.ErrorRate, 'f', 4, 64), strconv.FormatFloat(run.RPS, 'f', 2, 64), strconv.FormatInt(run.Bytes, 10),
+	}
+	for _, k := range latencyKeys {
+		header = append(header, k+"_ms")
+		row = append(row, strconv.FormatFloat(run.Latency[k], 'f', 3, 64))
+	}
+	f, err := os.OpenFile(base+".csv", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	w.WriteAll([][]string{header, row})
+	return w.Error()
+}
+
+func loadRun(name string) (*benchRun, error) {
+	b, err := ioutil.ReadFile(filepath.Join(benchDir(), name+".json"))
+	if err != nil {
+		return nil, err
+	}
+	var run benchRun
+	if err = json.Unmarshal(b, &run); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// runNames returns the saved runs, oldest first
+func runNames() []string {
+	files, _ := ioutil.ReadDir(benchDir())
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime().Before(files[j].ModTime()) })
+	var names []string
+	for _, f := range files {
+		if strings.HasSuffix(f.Name(), ".json") {
+			names = append(names, strings.TrimSuffix(f.Name(), ".json"))
+		}
+	}
+	return names
+}
+
+// runs   list saved bench runs
+func runsCommand(args []string) {
+	for _, name := range runNames() {
+		run, err := loadRun(name)
+		if err != nil {
+			fmt.Println(name, err)
+			continue
+		}
+		var mark string
+		if run.Cancelled {
+			mark = " (cancelled)"
+		}
+		fmt.Printf("  %-24s %s %s %s %.2f req/s p99 %.2fms%s\n", name, run.Time.Format("2006-01-02 15:04"), run.Request.Method, run.Request.URL, run.RPS, run.Latency["p99"], mark)
+	}
+}
+
+// compare <base> [run]   diff two bench runs, run defaults to the latest
+func compareCommand(args []string) {
+	if len(args) == 0 || len(args) > 2 {
+		fmt.Println("compare <base> [run], eg: compare before after")
+		return
+	}
+	name := ""
+	if len(args) == 2 {
+		name = args[1]
+	} else if names := runNames(); len(names) > 0 {
+		name = names[len(names)-1]
+	}
+	if name == args[0] {
+		fmt.Printf("Run `%s` compared with itself, compare <base> [run]\n", name)
+		return
+	}
+	base, err := loadRun(args[0])
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	run, err := loadRun(name)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	compareRuns(base, run)
+}
+
+func compareRuns(base, run *benchRun) {
+	bold := color.New(color.Bold)
+	bold.Printf("\n  %-14s %14s %14s %10s\n", "", base.Name, run.Name, "change")
+	if base.Request.Method != run.Request.Method || base.Request.URL != run.Request.URL {
+		color.Yellow("  requests differ: %s %s vs %s %s\n", base.Request.Method, base.Request.URL, run.Request.Method, run.Request.URL)
+	}
+	if base.Mode != run.Mode || base.Concurrency != run.Concurrency || base.Rate != run.Rate {
+		color.Yellow("  configs differ: %s vs %s\n", base.config(), run.config())
+	}
+
+	// higher tells whether a higher value is better
+	var line = func(label string, a, b float64, format string, higher bool) {
+		change, text := relChange(a, b)
+		c := color.New(color.Reset)
+		if (change > regression && !higher) || (change < -regression && higher) {
+			c = color.New(color.FgHiRed, color.Bold)
+			text += " ▲"
+		} else if (change > regression && higher) || (change < -regression && !higher) {
+			c = color.New(color.FgGreen)
+		}
+		fmt.Printf("  %-14s %14s %14s ", label, fmt.Sprintf(format, a), fmt.Sprintf(format, b))
+		c.Printf("%10s\n", text)
+	}
+	line("Requests/sec", base.RPS, run.RPS, "%.2f", true)
+	line("Error rate", base.ErrorRate*100, run.ErrorRate*100, "%.2f%%", false)
+	for _, k := range latencyKeys {
+		line(strings.ToUpper(k[:1])+k[1:]+" (ms)", base.Latency[k], run.Latency[k], "%.2f", false)
+	}
+	fmt.Println("")
+}
+
+// relChange returns (b-a)/a and its text
+func relChange(a, b float64) (float64, string) {
+	if a == b {
+		return 0, "0.0%"
+	}
+	if a == 0 {
+		return 1, "new"
+	}
+	change := (b - a) / a
+	return change, fmt.Sprintf("%+.1f%%", change*100)
+}
+
+func (run *benchRun) config() string {
+	switch run.Mode {
+	case "rate":
+		return fmt.Sprintf("rate %.2f/s %v", run.Rate, run.Duration)
+	case "stages":
+		return fmt.Sprintf("%d stages", len(run.Stages))
+	}
+	if run.Duration > 0 {
+		return fmt.Sprintf("%d workers %v", run.Concurrency, run.Duration)
+	}
+	return fmt.Sprintf("%d workers %d requests", run.Concurrency, run.Requests)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// sessionVars are {{name}} variables captured from responses
+var sessionVars = make(map[string]string)
+
+// capture evaluates source against the response of r, sources are
+//
+//	#data.token        gjson path of the body
+//	header.X-Token     response header
+//	cookie.SESSIONID   cookie set by the response
+//	~token=(\w+)       first group of a regexp matching the body
+func capture(r *Request, source string) (string, error) {
+	switch {
+	case strings.HasPrefix(source, "#") && len(source) > 1:
+		v := gjson.GetBytes(r.ResponseBody, source[1:])
+		if !v.Exists() {
+			return "", fmt.Errorf("`%s` not found", source)
+		}
+		return v.String(), nil
+	case strings.HasPrefix(source, "header."):
+		name := source[len("header."):]
+		if _, ok := r.ResponseHeader[http.CanonicalHeaderKey(name)]; !ok {
+			return "", fmt.Errorf("header `%s` not found", name)
+		}
+		return r.ResponseHeader.Get(name), nil
+	case strings.HasPrefix(source, "cookie."):
+		name := source[len("cookie."):]
+		resp := http.Response{Header: r.ResponseHeader}
+		for _, c := range resp.Cookies() {
+			if c.Name == name {
+				return c.Value, nil
+			}
+		}
+		return "", fmt.Errorf("cookie `%s` not found", name)
+	case strings.HasPrefix(source, "~"):
+		reg, err := regexp.Compile(source[1:])
+		if err != nil {
+			return "", err
+		}
+		m := reg.FindSubmatch(r.ResponseBody)
+		if m == nil {
+			return "", fmt.Errorf("`%s` not matched", source[1:])
+		}
+		if len(m) > 1 {
+			return string(m[1]), nil
+		}
+		return string(m[0]), nil
+	}
+	return "", fmt.Errorf("unknown capture source `%s`, eg: #data.token header.X-Token cookie.SID ~token=(\\w+)", source)
+}
+
+// applyCaptures stores the captured values of r, names prefixed with
+// `env.` are saved into the active environment
+func applyCaptures(r *Request) {
+	var save bool
+	for _, name := range sortedStringKeys(r.Captures) {
+		v, err := capture(r, r.Captures[name])
+		if err != nil {
+			r.error(">", name, err)
+			continue
+		}
+		key := strings.TrimPrefix(name, "env.")
+		if e, ok := environments[activeEnv]; ok && key != name {
+			e.Vars[key] = v
+			save = true
+		} else {
+			if key != name {
+				fmt.Println("> No active environment, keep", key, "in session")
+			}
+			sessionVars[key] = v
+		}
+		suggest.AddSuggest("{{" + key + "}}")
+		fmt.Printf("> %s = %s\n", key, v)
+	}
+	if save {
+		saveEnvironments()
+	}
+}
+
+func sortedStringKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+)
+
+// oneShot sends the request described by the command line and exits, eg:
+//
+//	httpgo POST :8080/users name=x age=:3 Auth:token
+//	echo '{"name":"x"}' | httpgo PUT :8080/users/1
+//
+// or runs a script with `httpgo -f script.http`.
+//
+// The exit status is 0 for 2xx responses, 3, 4 and 5 for 3xx, 4xx and 5xx,
+// 2 when the request timed out and 1 for other errors. A request with
+// assertions exits 0 when they pass and 1 when one fails.
+func oneShot(args []string) int {
+	interactive = false
+	verbose = false
+	errOut = os.Stderr
+	if len(args) > 0 && (args[0] == "-v" || args[0] == "--verbose") {
+		verbose = true
+		args = args[1:]
+	}
+	loadInitEnv()
+
+	if len(args) == 2 && args[0] == "-f" {
+		if runScript(args[1]) > 0 {
+			return 1
+		}
+		return 0
+	}
+
+	// a body piped to stdin is sent when the arguments give none, - reads
+	// stdin in any case
+	var stdin bool
+	for i, arg := range args {
+		if arg == "-" {
+			stdin = true
+			args = append(args[:i:i], args[i+1:]...)
+			break
+		}
+	}
+
+	req.Call = true
+	var tokenizer Tokenizer
+	tokenizer.InitArgs(args)
+	parseTokens(&tokenizer)
+	if !req.Call {
+		return 1
+	}
+	if req.URL == nil {
+		fmt.Fprintln(os.Stderr, "URL not set")
+		return 1
+	}
+
+	noBody := req.Body.Len() == 0 && len(req.Fields) == 0 && len(req.Files) == 0 && len(req.JSONMap) == 0
+	if stdin && !noBody {
+		fmt.Fprintln(os.Stderr, "body set by the arguments and - at once")
+		return 1
+	}
+	if fi, err := os.Stdin.Stat(); err == nil && fi.Mode()&os.ModeCharDevice == 0 && noBody {
+		stdin = true
+	}
+	if stdin {
+		b, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if len(b) > 0 {
+			req.Body.Write(b)
+			if req.Method == GET {
+				req.Method = POST
+			}
+		}
+	}
+
+	if err := doRequest(); err != nil {
+		if e, ok := err.(net.Error); ok && e.Timeout() {
+			return 2
+		}
+		return 1
+	}
+	if req.Bench {
+		return 0
+	}
+	// assertions decide when there are some, ?status==404 passes
+	if len(req.Asserts) > 0 {
+		if assertFailures > 0 {
+			return 1
+		}
+		return 0
+	}
+	switch req.ResponseStatus / 100 {
+	case 3, 4, 5:
+		return req.ResponseStatus / 100
+	}
+	return 0
+}
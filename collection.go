@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const collectionFile = "collection.json"
+
+var collection []CollectionItem
+
+// CollectionItem is a saved request, folders are separated by `/` in Name
+type CollectionItem struct {
+	Name    string      `json:"name"`
+	Request RequestData `json:"request"`
+}
+
+func loadCollection() {
+	content, err := ioutil.ReadFile(collectionFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Println("Read file", collectionFile, err)
+		}
+		return
+	}
+	if err = json.Unmarshal(content, &collection); err != nil {
+		fmt.Println("Unmarshal", collectionFile, err)
+		return
+	}
+	for _, item := range collection {
+		suggest.AddSuggest(item.Name)
+	}
+}
+
+func saveCollection() bool {
+	b, err := json.MarshalIndent(collection, "", "  ")
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	if err = ioutil.WriteFile(collectionFile, b, 0644); err != nil {
+		fmt.Println(err)
+		return false
+	}
+	return true
+}
+
+func findCollection(name string) int {
+	for i := range collection {
+		if collection[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// inFolder reports whether name is folder itself or lives under it
+func inFolder(name, folder string) bool {
+	folder = strings.TrimSuffix(folder, "/")
+	return folder == "" || name == folder || strings.HasPrefix(name, folder+"/")
+}
+
+// save <name>
+func saveCommand(args []string) {
+	if len(args) != 1 {
+		fmt.Println("save <name>, eg: save users/create")
+		return
+	}
+	if req.URL == nil {
+		fmt.Println("URL not set")
+		return
+	}
+	item := CollectionItem{Name: strings.Trim(args[0], "/"), Request: req.data()}
+	if i := findCollection(item.Name); i >= 0 {
+		collection[i] = item
+	} else {
+		collection = append(collection, item)
+	}
+	if saveCollection() {
+		suggest.AddSuggest(item.Name)
+		fmt.Printf("> Save `%s` to %s\n", item.Name, collectionFile)
+	}
+}
+
+// load <name>
+func loadCommand(args []string) {
+	if len(args) != 1 {
+		fmt.Println("load <name>")
+		return
+	}
+	i := findCollection(args[0])
+	if i < 0 {
+		fmt.Printf("`%s` not found\n", args[0])
+		return
+	}
+	r, err := collection[i].Request.request()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	req = r
+	changePrefix()
+}
+
+// ls [folder]
+func lsCommand(args []string) {
+	var folder string
+	if len(args) > 0 {
+		folder = args[0]
+	}
+	for _, item := range collection {
+		if inFolder(item.Name, folder) {
+			fmt.Printf("  %-30s %s %s\n", item.Name, item.Request.Method, item.Request.URL)
+		}
+	}
+}
+
+// rm <name|folder>
+func rmCommand(args []string) {
+	if len(args) != 1 || strings.Trim(args[0], "/") == "" {
+		fmt.Println("rm <name|folder>")
+		return
+	}
+	items := collection[:0]
+	for _, item := range collection {
+		if !inFolder(item.Name, args[0]) {
+			items = append(items, item)
+		}
+	}
+	if len(items) == len(collection) {
+		fmt.Printf("`%s` not found\n", args[0])
+		return
+	}
+	collection = items
+	saveCollection()
+}
+
+// mv <old> <new>, renames a request or a whole folder
+func mvCommand(args []string) {
+	if len(args) != 2 {
+		fmt.Println("mv <old> <new>")
+		return
+	}
+	from, to := strings.Trim(args[0], "/"), strings.Trim(args[1], "/")
+	if from == "" || to == "" {
+		fmt.Println("mv <old> <new>")
+		return
+	}
+	// new names of the moved items, none may take the name of another item
+	names := make(map[int]string)
+	for i := range collection {
+		if inFolder(collection[i].Name, from) {
+			names[i] = to + strings.TrimPrefix(collection[i].Name, from)
+		}
+	}
+	if len(names) == 0 {
+		fmt.Printf("`%s` not found\n", args[0])
+		return
+	}
+	for i := range collection {
+		if _, moved := names[i]; moved {
+			continue
+		}
+		for _, name := range names {
+			if collection[i].Name == name {
+				fmt.Printf("`%s` exists, rm it first\n", name)
+				return
+			}
+		}
+	}
+	for i, name := range names {
+		collection[i].Name = name
+		suggest.AddSuggest(name)
+	}
+	saveCollection()
+}
+
+// run [folder], sends every request of the folder in order
+func runCommand(args []string) {
+	var folder string
+	if len(args) > 0 {
+		folder = args[0]
+	}
+	for _, item := range collection {
+		if !inFolder(item.Name, folder) {
+			continue
+		}
+		r, err := item.Request.request()
+		if err != nil {
+			fmt.Println(item.Name, err)
+			continue
+		}
+		fmt.Printf("> Run `%s`\n", item.Name)
+		if r.Proxy == "" {
+			r.Proxy = req.Proxy
+		}
+		req = r
+		httpCall()
+	}
+	changePrefix()
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// jars are the cookie jars of each environment, "" without one
+	jars   = make(map[string]*cookieJar)
+	jarsMu sync.Mutex
+)
+
+// Cookie is a stored cookie, HostOnly cookies are sent to Domain only
+type Cookie struct {
+	Name     string    `json:"name"`
+	Value    string    `json:"value"`
+	Domain   string    `json:"domain"`
+	Path     string    `json:"path"`
+	HostOnly bool      `json:"host_only,omitempty"`
+	Expires  time.Time `json:"expires,omitempty"`
+	Secure   bool      `json:"secure,omitempty"`
+	HttpOnly bool      `json:"http_only,omitempty"`
+}
+
+func (c *Cookie) expired() bool {
+	return !c.Expires.IsZero() && c.Expires.Before(time.Now())
+}
+
+func (c *Cookie) url() *url.URL {
+	u := &url.URL{Scheme: "http", Host: c.Domain, Path: c.Path}
+	if c.Secure {
+		u.Scheme = "https"
+	}
+	return u
+}
+
+func (c *Cookie) httpCookie() *http.Cookie {
+	hc := &http.Cookie{Name: c.Name, Value: c.Value, Path: c.Path, Expires: c.Expires, Secure: c.Secure, HttpOnly: c.HttpOnly}
+	if !c.HostOnly {
+		hc.Domain = c.Domain
+	}
+	return hc
+}
+
+// cookieJar is a http.CookieJar that keeps its cookies so they can be
+// listed, edited and saved
+type cookieJar struct {
+	mu      sync.Mutex
+	env     string
+	jar     *cookiejar.Jar
+	cookies []*Cookie
+	dirty   bool
+	// persist saves the jar, PersistCookies of the environment
+	persist bool
+}
+
+func newCookieJar(env string) *cookieJar {
+	jar, _ := cookiejar.New(nil)
+	return &cookieJar{env: env, jar: jar}
+}
+
+// defaultPath is the path of a cookie without one, the directory of the
+// request path as in RFC 6265 5.1.4
+func defaultPath(p string) string {
+	i := strings.LastIndex(p, "/")
+	if p == "" || p[0] != '/' || i <= 0 {
+		return "/"
+	}
+	return p[:i]
+}
+
+func (j *cookieJar) Cookies(u *url.URL) []*http.Cookie {
+	j.mu.Lock()
+	jar := j.jar
+	j.mu.Unlock()
+	return jar.Cookies(u)
+}
+
+func (j *cookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.jar.SetCookies(u, cookies)
+	for _, hc := range cookies {
+		c := &Cookie{Name: hc.Name, Value: hc.Value, Domain: strings.TrimPrefix(hc.Domain, "."), Path: hc.Path,
+			Expires: hc.Expires, Secure: hc.Secure, HttpOnly: hc.HttpOnly}
+		if c.Domain == "" {
+			c.Domain, c.HostOnly = u.Hostname(), true
+		}
+		if c.Path == "" || c.Path[0] != '/' {
+			c.Path = defaultPath(u.Path)
+		}
+		if hc.MaxAge > 0 {
+			c.Expires = time.Now().Add(time.Duration(hc.MaxAge) * time.Second)
+		} else if hc.MaxAge < 0 {
+			c.Expires = time.Unix(1, 0)
+		}
+		if c.expired() {
+			j.remove(c.Domain, c.Path, c.Name)
+			j.dirty = true
+		} else if j.accepted(c) {
+			// the jar refuses a domain that does not match the host
+			j.remove(c.Domain, c.Path, c.Name)
+			j.cookies = append(j.cookies, c)
+			j.dirty = true
+		}
+	}
+}
+
+// accepted reports whether the jar holds c, j.mu must be held
+func (j *cookieJar) accepted(c *Cookie) bool {
+	for _, hc := range j.jar.Cookies(c.url()) {
+		if hc.Name == c.Name && hc.Value == c.Value {
+			return true
+		}
+	}
+	return false
+}
+
+func (j *cookieJar) remove(domain, path, name string) {
+	for i, c := range j.cookies {
+		if c.Domain == domain && c.Path == path && c.Name == name {
+			j.cookies = append(j.cookies[:i], j.cookies[i+1:]...)
+			return
+		}
+	}
+}
+
+// delete removes the cookies of host, all of them when name is empty
+func (j *cookieJar) delete(host, name string) int {
+	var n int
+	for _, c := range j.list(host) {
+		if name != "" && c.Name != name {
+			continue
+		}
+		d := *c
+		d.Expires = time.Unix(1, 0)
+		j.mu.Lock()
+		j.jar.SetCookies(d.url(), []*http.Cookie{d.httpCookie()})
+		j.remove(c.Domain, c.Path, c.Name)
+		j.dirty = true
+		j.mu.Unlock()
+		n++
+	}
+	return n
+}
+
+// list returns the live cookies of host, all of them when host is empty
+func (j *cookieJar) list(host string) []*Cookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var cookies []*Cookie
+	for _, c := range j.cookies {
+		if c.expired() {
+			continue
+		}
+		if host == "" || host == c.Domain || (!c.HostOnly && strings.HasSuffix(host, "."+c.Domain)) {
+			cookies = append(cookies, c)
+		}
+	}
+	sort.Slice(cookies, func(i, k int) bool {
+		if cookies[i].Domain != cookies[k].Domain {
+			return cookies[i].Domain < cookies[k].Domain
+		}
+		return cookies[i].Name < cookies[k].Name
+	})
+	return cookies
+}
+
+func (j *cookieJar) file() string {
+	dir := dataPath("cookies")
+	os.MkdirAll(dir, 0700)
+	return filepath.Join(dir, j.env+".json")
+}
+
+func (j *cookieJar) load() {
+	content, err := ioutil.ReadFile(j.file())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Println("Read file", j.file(), err)
+		}
+		return
+	}
+	var cookies []*Cookie
+	if err = json.Unmarshal(content, &cookies); err != nil {
+		fmt.Println("Unmarshal", j.file(), err)
+		return
+	}
+	// through SetCookies so the jar checks them again
+	for _, c := range cookies {
+		j.SetCookies(c.url(), []*http.Cookie{c.httpCookie()})
+	}
+	j.mu.Lock()
+	j.dirty = false
+	j.mu.Unlock()
+}
+
+// save writes the jar of a persisted environment when it changed
+func (j *cookieJar) save() {
+	j.mu.Lock()
+	dirty := j.dirty && j.persist
+	j.dirty = false
+	j.mu.Unlock()
+	if !dirty {
+		return
+	}
+	b, err := json.Marshal(j.list(""))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if err = ioutil.WriteFile(j.file(), b, 0600); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// currentJar returns the jar of the active environment
+func currentJar() *cookieJar {
+	jarsMu.Lock()
+	defer jarsMu.Unlock()
+	j, ok := jars[activeEnv]
+	if !ok {
+		j = newCookieJar(activeEnv)
+		if e, ok := environments[activeEnv]; ok && e.PersistCookies {
+			j.persist = true
+			j.load()
+		}
+		jars[activeEnv] = j
+	}
+	return j
+}
+
+func currentHost() string {
+	if req.URL == nil {
+		return ""
+	}
+	return req.URL.Hostname()
+}
+
+// cookie [ls] [host]              list cookies
+// cookie send                     cookies sent with the current request
+// cookie set name=value [host]    set a cookie
+// cookie rm name [host]           delete a cookie
+// cookie clear [host]             delete all cookies
+// cookie persist on|off           save the jar of the active environment
+func cookieCommand(args []string) {
+	j := currentJar()
+	if len(args) == 0 {
+		args = []string{"ls"}
+	}
+	var host = func(i int) string {
+		if len(args) > i {
+			return args[i]
+		}
+		return currentHost()
+	}
+	switch args[0] {
+	case "ls":
+		h := ""
+		if len(args) > 1 {
+			h = args[1]
+		}
+		for _, c := range j.list(h) {
+			printCookie(c)
+		}
+	case "send":
+		if req.URL == nil {
+			fmt.Println("URL not set")
+			return
+		}
+		for _, c := range j.Cookies(req.URL) {
+			fmt.Printf("  %s=%s\n", c.Name, c.Value)
+		}
+	case "set":
+		if len(args) < 2 || !strings.Contains(args[1], "=") {
+			fmt.Println("cookie set name=value [host], eg: cookie set SID=abc localhost")
+			return
+		}
+		h := host(2)
+		if h == "" {
+			fmt.Println("URL not set, cookie set name=value <host>")
+			return
+		}
+		nv := strings.SplitN(args[1], "=", 2)
+		j.SetCookies(&url.URL{Scheme: "http", Host: h, Path: "/"}, []*http.Cookie{{Name: nv[0], Value: nv[1], Path: "/"}})
+	case "rm":
+		if len(args) < 2 {
+			fmt.Println("cookie rm name [host]")
+			return
+		}
+		fmt.Printf("> Removed %d cookies\n", j.delete(host(2), args[1]))
+	case "clear":
+		if len(args) > 1 {
+			fmt.Printf("> Removed %d cookies\n", j.delete(args[1], ""))
+			break
+		}
+		j.mu.Lock()
+		j.jar, _ = cookiejar.New(nil)
+		j.cookies = nil
+		j.dirty = true
+		j.mu.Unlock()
+	case "persist":
+		e, ok := environments[activeEnv]
+		if !ok {
+			fmt.Println("No active environment, use `env <name>` first")
+			return
+		}
+		e.PersistCookies = len(args) < 2 || args[1] != "off"
+		saveEnvironments()
+		j.mu.Lock()
+		j.persist, j.dirty = e.PersistCookies, true
+		j.mu.Unlock()
+	default:
+		fmt.Println("cookie [ls [host]|send|set name=value [host]|rm name [host]|clear [host]|persist on|off]")
+		return
+	}
+	j.save()
+}
+
+func printCookie(c *Cookie) {
+	var flags []string
+	if c.HostOnly {
+		flags = append(flags, "host-only")
+	}
+	if c.Secure {
+		flags = append(flags, "secure")
+	}
+	if c.HttpOnly {
+		flags = append(flags, "httponly")
+	}
+	expires := "session"
+	if !c.Expires.IsZero() {
+		expires = c.Expires.Format("2006-01-02 15:04")
+	}
+	fmt.Printf("  %-20s %s=%s  path=%s  expires=%s %s\n", c.Domain, c.Name, c.Value, c.Path, expires, strings.Join(flags, " "))
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestCookieJar(t *testing.T) {
+	j := newCookieJar("")
+	u, _ := url.Parse("http://api.example.com/login")
+	j.SetCookies(u, []*http.Cookie{
+		{Name: "SID", Value: "1", Path: "/"},
+		{Name: "lang", Value: "en", Domain: ".example.com"},
+		{Name: "old", Value: "x", MaxAge: -1},
+	})
+
+	if n := len(j.list("")); n != 2 {
+		t.Errorf("expected %d, actual %d", 2, n)
+	}
+	if n := len(j.list("www.example.com")); n != 1 {
+		t.Errorf("expected %d, actual %d", 1, n)
+	}
+	if n := len(j.Cookies(u)); n != 2 {
+		t.Errorf("expected %d, actual %d", 2, n)
+	}
+
+	if n := j.delete("api.example.com", "SID"); n != 1 {
+		t.Errorf("expected %d, actual %d", 1, n)
+	}
+	cookies := j.Cookies(u)
+	if len(cookies) != 1 || cookies[0].Name != "lang" {
+		t.Errorf("expected %s, actual %v", "lang", cookies)
+	}
+}
+
+func TestCookieJarRejected(t *testing.T) {
+	j := newCookieJar("")
+	u, _ := url.Parse("http://api.example.com/v1/login")
+	j.SetCookies(u, []*http.Cookie{
+		{Name: "evil", Value: "1", Domain: "other.com"},
+		{Name: "SID", Value: "2"},
+	})
+
+	cookies := j.list("")
+	if len(cookies) != 1 || cookies[0].Name != "SID" {
+		t.Fatalf("expected %s, actual %v", "SID", cookies)
+	}
+	if cookies[0].Path != "/v1" {
+		t.Errorf("expected %s, actual %s", "/v1", cookies[0].Path)
+	}
+	other, _ := url.Parse("http://other.com/")
+	if n := len(j.Cookies(other)); n != 0 {
+		t.Errorf("expected %d, actual %d", 0, n)
+	}
+}
+
+func TestCookieJarPersist(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	j := newCookieJar("test")
+	j.persist = true
+	u, _ := url.Parse("https://api.example.com/")
+	j.SetCookies(u, []*http.Cookie{
+		{Name: "SID", Value: "1", Secure: true},
+		{Name: "lang", Value: "en", Domain: "example.com", Path: "/docs"},
+	})
+	j.save()
+
+	loaded := newCookieJar("test")
+	loaded.load()
+	cookies := loaded.list("")
+	if len(cookies) != 2 || !cookies[0].HostOnly || cookies[1].Path != "/docs" {
+		t.Errorf("expected %v, actual %v", j.list(""), cookies)
+	}
+	if n := len(loaded.Cookies(u)); n != 1 {
+		t.Errorf("expected %d, actual %d", 1, n)
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// curlBuf holds a pasted curl command until its last `\` continued line
+var curlBuf bytes.Buffer
+
+// pasteCurl collects a curl command line by line and imports it into req
+// once the last line has no trailing `\`
+func pasteCurl(in string) {
+	if strings.HasSuffix(in, "\\") {
+		curlBuf.WriteString(strings.TrimSuffix(in, "\\"))
+		curlBuf.WriteString(" ")
+		LivePrefixState.IsEnable = true
+		LivePrefixState.LivePrefix = "... > "
+		return
+	}
+	curlBuf.WriteString(in)
+	cmd := curlBuf.String()
+	curlBuf.Reset()
+
+	r, err := parseCurl(cmd)
+	if err != nil {
+		fmt.Println(err)
+		changePrefix()
+		return
+	}
+	if r.Proxy == "" {
+		r.Proxy = req.Proxy
+	}
+	req = r
+	suggest.AddSuggest(req.URL.String())
+	suggest.AddSuggest(req.URL.RequestURI())
+	changePrefix()
+}
+
+// parseCurl converts a curl command line into a Request
+func parseCurl(cmd string) (*Request, error) {
+	args, err := shellSplit(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 || args[0] != "curl" {
+		return nil, fmt.Errorf("not a curl command")
+	}
+
+	r := newReq()
+	var (
+		rawURL string
+		data   []string
+		get    bool
+		isForm bool
+	)
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		name, val, hasVal := arg, "", false
+		if strings.HasPrefix(arg, "--") {
+			if idx := strings.Index(arg, "="); idx > 0 {
+				name, val, hasVal = arg[:idx], arg[idx+1:], true
+			}
+		} else if strings.HasPrefix(arg, "-") && len(arg) > 2 && strings.ContainsRune("XHdFuxAebo", rune(arg[1])) {
+			// -XPOST
+			name, val, hasVal = arg[:2], arg[2:], true
+		}
+		value := func() string {
+			if hasVal {
+				return val
+			}
+			i++
+			if i < len(args) {
+				return args[i]
+			}
+			return ""
+		}
+
+		switch name {
+		case "-X", "--request":
+			r.Method = strings.ToUpper(value())
+		case "-H", "--header":
+			pair := strings.SplitN(value(), ":", 2)
+			if len(pair) == 2 {
+				r.Header.Add(strings.TrimSpace(pair[0]), strings.TrimSpace(pair[1]))
+			}
+		case "-d", "--data", "--data-ascii", "--data-binary", "--data-urlencode":
+			v := value()
+			if strings.HasPrefix(v, "@") && name != "--data-urlencode" {
+				v = string(readFile(v[1:]))
+				if name != "--data-binary" {
+					v = strings.NewReplacer("\r", "", "\n", "").Replace(v)
+				}
+			} else if name == "--data-urlencode" {
+				if idx := strings.Index(v, "="); idx >= 0 {
+					v = v[:idx+1] + url.QueryEscape(v[idx+1:])
+				} else {
+					v = url.QueryEscape(v)
+				}
+			}
+			data = append(data, v)
+		case "--data-raw":
+			data = append(data, value())
+		case "-F", "--form":
+			pair := strings.SplitN(value(), "=", 2)
+			if len(pair) != 2 {
+				continue
+			}
+			// -F is always multipart/form-data
+			isForm, r.Multipart = true, true
+			if strings.HasPrefix(pair[1], "@") {
+				// name=@file;type=text/plain
+				r.Files.Add(pair[0], strings.SplitN(pair[1][1:], ";", 2)[0])
+			} else {
+				r.Fields.Add(pair[0], pair[1])
+			}
+		case "-u", "--user":
+			pair := strings.SplitN(value(), ":", 2)
+			r.Username = pair[0]
+			if len(pair) > 1 {
+				r.Password = pair[1]
+			}
+		case "--digest":
+			r.AuthType = "digest"
+		case "--basic":
+			r.AuthType = ""
+		case "-x", "--proxy":
+			r.Proxy = value()
+		case "-A", "--user-agent":
+			r.Header.Set("User-Agent", value())
+		case "-e", "--referer":
+			r.Header.Set("Referer", value())
+		case "-b", "--cookie":
+			r.Header.Add("Cookie", value())
+		case "-k", "--insecure":
+			r.TLS.Insecure = true
+		case "--http1.1", "--http1.0":
+			r.Proto = "http1"
+		case "--http2":
+			r.Proto = "h2"
+		case "--http2-prior-knowledge":
+			r.Proto = "h2c"
+		case "-G", "--get":
+			get = true
+		case "--url":
+			rawURL = value()
+		case "--compressed":
+			// net/http asks for and decodes gzip by itself
+		case "-o", "--output", "-m", "--max-time", "--connect-timeout", "--retry", "-w", "--write-out":
+			value()
+		default:
+			if !strings.HasPrefix(arg, "-") && rawURL == "" {
+				rawURL = arg
+			}
+		}
+	}
+
+	if rawURL == "" {
+		return nil, fmt.Errorf("curl: no URL specified")
+	}
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	r.Values = u.Query()
+	u.RawQuery = ""
+	r.URL = u
+
+	body := strings.Join(data, "&")
+	if get {
+		if q, err := url.ParseQuery(body); err == nil {
+			for k, v := range q {
+				r.Values[k] = append(r.Values[k], v...)
+			}
+		}
+	} else if len(data) > 0 {
+		ct := r.Header.Get("Content-Type")
+		if q, err := url.ParseQuery(body); err == nil && strings.Contains(body, "=") &&
+			(ct == "" || strings.HasPrefix(ct, "application/x-www-form-urlencoded")) &&
+			!strings.HasPrefix(body, "{") && !strings.HasPrefix(body, "[") {
+			r.Fields = q
+			isForm = true
+		} else {
+			r.Body.WriteString(body)
+		}
+	}
+	if isForm {
+		r.JSON = false
+		r.Form = true
+	}
+
+	if r.Method == "" {
+		r.Method = GET
+		if !get && (len(data) > 0 || len(r.Fields) > 0 || len(r.Files) > 0) {
+			r.Method = POST
+		}
+	}
+	return r, nil
+}
+
+// shellSplit splits s into words the way a POSIX shell would, handling
+// quotes, $'...' strings, backslash escapes and line continuations
+func shellSplit(s string) ([]string, error) {
+	var (
+		args    []string
+		word    bytes.Buffer
+		inWord  bool
+		rs      = []rune(s)
+		escapes = map[rune]rune{'n': '\n', 't': '\t', 'r': '\r', '\\': '\\', '\'': '\'', '"': '"', '0': 0}
+	)
+	for i := 0; i < len(rs); i++ {
+		ch := rs[i]
+		switch {
+		case ch == '\\':
+			if i+1 < len(rs) {
+				i++
+				if rs[i] == '\n' {
+					continue
+				}
+				word.WriteRune(rs[i])
+				inWord = true
+			}
+		case ch == '$' && i+1 < len(rs) && rs[i+1] == '\'':
+			i += 2
+			for ; i < len(rs) && rs[i] != '\''; i++ {
+				if rs[i] == '\\' && i+1 < len(rs) {
+					i++
+					if e, ok := escapes[rs[i]]; ok {
+						word.WriteRune(e)
+						continue
+					}
+					word.WriteRune('\\')
+				}
+				word.WriteRune(rs[i])
+			}
+			if i >= len(rs) {
+				return nil, fmt.Errorf("unterminated quote")
+			}
+			inWord = true
+		case ch == '\'':
+			i++
+			for ; i < len(rs) && rs[i] != '\''; i++ {
+				word.WriteRune(rs[i])
+			}
+			if i >= len(rs) {
+				return nil, fmt.Errorf("unterminated quote")
+			}
+			inWord = true
+		case ch == '"':
+			i++
+			for ; i < len(rs) && rs[i] != '"'; i++ {
+				if rs[i] == '\\' && i+1 < len(rs) && strings.ContainsRune("\"\\$`\n", rs[i+1]) {
+					i++
+					if rs[i] == '\n' {
+						continue
+					}
+				}
+				word.WriteRune(rs[i])
+			}
+			if i >= len(rs) {
+				return nil, fmt.Errorf("unterminated quote")
+			}
+			inWord = true
+		case isWhitespace(ch):
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(ch)
+			inWord = true
+		}
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	return args, nil
+}
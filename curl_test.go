@@ -0,0 +1,103 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestShellSplit(t *testing.T) {
+	args, err := shellSplit("curl 'http://a.com/x?y=1' \\\n  -H \"X-A: \\\"b\\\"\" --data-raw $'{\"c\":\\'d\\'}'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"curl", "http://a.com/x?y=1", "-H", `X-A: "b"`, "--data-raw", `{"c":'d'}`}
+	if len(args) != len(expected) {
+		t.Fatalf("expected %q, actual %q", expected, args)
+	}
+	for i := range expected {
+		if args[i] != expected[i] {
+			t.Errorf("expected %s, actual %s", expected[i], args[i])
+		}
+	}
+}
+
+func TestShellSplitUnterminated(t *testing.T) {
+	if _, err := shellSplit(`curl 'http://a.com`); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestCurlJSON(t *testing.T) {
+	r, err := parseCurl(`curl -X PUT 'https://a.com/users/1?v=2' -H 'Content-Type: application/json' -d '{"name":"x"}' -u root:p:w -k --compressed --http2`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Method != PUT {
+		t.Errorf("expected %s, actual %s", PUT, r.Method)
+	}
+	if r.URL.String() != "https://a.com/users/1" {
+		t.Errorf("expected %s, actual %s", "https://a.com/users/1", r.URL)
+	}
+	if r.Values.Get("v") != "2" {
+		t.Errorf("expected %s, actual %s", "2", r.Values.Get("v"))
+	}
+	if r.Body.String() != `{"name":"x"}` {
+		t.Errorf("expected %s, actual %s", `{"name":"x"}`, r.Body.String())
+	}
+	if r.Username != "root" || r.Password != "p:w" {
+		t.Errorf("expected %s, actual %s:%s", "root:p:w", r.Username, r.Password)
+	}
+	if !r.TLS.Insecure {
+		t.Error("expected insecure")
+	}
+	if r.Proto != "h2" {
+		t.Errorf("expected %s, actual %s", "h2", r.Proto)
+	}
+}
+
+func TestCurlForm(t *testing.T) {
+	r, err := parseCurl(`curl a.com/upload -F name=x -F file=@/tmp/a.txt;type=text/plain -x http://proxy:3128`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Method != POST {
+		t.Errorf("expected %s, actual %s", POST, r.Method)
+	}
+	if r.Fields.Get("name") != "x" {
+		t.Errorf("expected %s, actual %s", "x", r.Fields.Get("name"))
+	}
+	if r.Files.Get("file") != "/tmp/a.txt" {
+		t.Errorf("expected %s, actual %s", "/tmp/a.txt", r.Files.Get("file"))
+	}
+	if r.Proxy != "http://proxy:3128" {
+		t.Errorf("expected %s, actual %s", "http://proxy:3128", r.Proxy)
+	}
+}
+
+func TestCurlFormFields(t *testing.T) {
+	r, err := parseCurl(`curl a.com/profile -F name=x -F age=3`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpReq, err := r.newHTTPRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct := httpReq.Header.Get("Content-Type")
+	if !strings.HasPrefix(ct, "multipart/form-data; boundary=") {
+		t.Errorf("expected %s, actual %s", "multipart/form-data", ct)
+	}
+	if err = httpReq.ParseMultipartForm(1 << 20); err != nil || httpReq.FormValue("age") != "3" {
+		t.Errorf("expected %s, actual %s %v", "3", httpReq.FormValue("age"), err)
+	}
+}
+
+func TestCurlURLEncoded(t *testing.T) {
+	r, err := parseCurl(`curl -XPOST http://a.com/login -d 'user=a&pass=b'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Form || r.Fields.Get("user") != "a" || r.Fields.Get("pass") != "b" {
+		t.Errorf("expected form fields, actual %v", r.Fields)
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// digests are the digest challenges of each protection space, kept for the
+// session so the nonce count goes on across requests and bench runs
+var (
+	digestMu sync.Mutex
+	digests  = make(map[string]*digestSession)
+)
+
+// digestChallenge is a `WWW-Authenticate: Digest` challenge, RFC 7616
+type digestChallenge struct {
+	Realm     string
+	Nonce     string
+	Opaque    string
+	Algorithm string
+	Qop       []string
+	Stale     bool
+	Userhash  bool
+}
+
+// digestSession is a challenge and the number of requests sent with its
+// nonce. The workers of a bench share it, nc is taken in order but requests
+// may reach the server out of order, which a server that requires strictly
+// increasing nonce counts refuses.
+type digestSession struct {
+	mu        sync.Mutex
+	challenge *digestChallenge
+	nc        uint32
+	cnonce    string
+}
+
+// parseDigest returns the strongest digest challenge of the WWW-Authenticate
+// headers, SHA-256 before MD5
+func parseDigest(headers []string) (*digestChallenge, error) {
+	var best *digestChallenge
+	for _, h := range headers {
+		for _, c := range splitChallenges(h) {
+			if !strings.EqualFold(c.scheme, "digest") {
+				continue
+			}
+			dc := &digestChallenge{
+				Realm:     c.params["realm"],
+				Nonce:     c.params["nonce"],
+				Opaque:    c.params["opaque"],
+				Algorithm: c.params["algorithm"],
+				Stale:     strings.EqualFold(c.params["stale"], "true"),
+				Userhash:  strings.EqualFold(c.params["userhash"], "true"),
+			}
+			if dc.Algorithm == "" {
+				dc.Algorithm = "MD5"
+			}
+			for _, q := range strings.Split(c.params["qop"], ",") {
+				if q = strings.TrimSpace(q); q != "" {
+					dc.Qop = append(dc.Qop, q)
+				}
+			}
+			if dc.Nonce == "" || digestHash(dc.Algorithm) == nil {
+				continue
+			}
+			if best == nil || (strings.HasPrefix(strings.ToUpper(dc.Algorithm), "SHA-256") &&
+				!strings.HasPrefix(strings.ToUpper(best.Algorithm), "SHA-256")) {
+				best = dc
+			}
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("no supported Digest challenge in WWW-Authenticate")
+	}
+	return best, nil
+}
+
+type authChallenge struct {
+	scheme string
+	params map[string]string
+}
+
+// splitChallenges parses a WWW-Authenticate header, which may hold several
+// challenges separated by commas like the parameters
+func splitChallenges(h string) []authChallenge {
+	var (
+		challenges []authChallenge
+		i          int
+	)
+	for i < len(h) {
+		for i < len(h) && (h[i] == ' ' || h[i] == ',') {
+			i++
+		}
+		start := i
+		for i < len(h) && h[i] != ' ' && h[i] != '=' && h[i] != ',' {
+			i++
+		}
+		token := h[start:i]
+		if token == "" {
+			break
+		}
+		if i < len(h) && h[i] == '=' && len(challenges) > 0 {
+			// a parameter of the current challenge
+			i++
+			var value string
+			if i < len(h) && h[i] == '"' {
+				var b strings.Builder
+				for i++; i < len(h) && h[i] != '"'; i++ {
+					if h[i] == '\\' && i+1 < len(h) {
+						i++
+					}
+					b.WriteByte(h[i])
+				}
+				i++
+				value = b.String()
+			} else {
+				start = i
+				for i < len(h) && h[i] != ',' {
+					i++
+				}
+				value = strings.TrimSpace(h[start:i])
+			}
+			challenges[len(challenges)-1].params[strings.ToLower(token)] = value
+			continue
+		}
+		challenges = append(challenges, authChallenge{scheme: token, params: make(map[string]string)})
+	}
+	return challenges
+}
+
+func digestHash(algorithm string) func() hash.Hash {
+	switch strings.ToUpper(strings.TrimSuffix(strings.ToLower(algorithm), "-sess")) {
+	case "MD5":
+		return md5.New
+	case "SHA-256":
+		return sha256.New
+	}
+	return nil
+}
+
+func digestSpace(r *http.Request) string {
+	return r.URL.Scheme + "://" + r.URL.Host
+}
+
+// digestChallenged stores the digest challenge of a 401 response to r, it
+// returns false when the request should not be sent again: no challenge or
+// the credentials were refused with a nonce that is not stale. The session
+// is dropped then, the server may have expired the nonce without saying so
+// and the next request gets a new challenge.
+func digestChallenged(r *http.Request, resp *http.Response) bool {
+	c, err := parseDigest(resp.Header.Values("WWW-Authenticate"))
+	if err != nil {
+		return false
+	}
+	sent := strings.HasPrefix(r.Header.Get("Authorization"), "Digest ")
+	if sent && !c.Stale {
+		digestMu.Lock()
+		delete(digests, digestSpace(r))
+		digestMu.Unlock()
+		return false
+	}
+	b := make([]byte, 8)
+	rand.Read(b)
+	digestMu.Lock()
+	digests[digestSpace(r)] = &digestSession{challenge: c, cnonce: hex.EncodeToString(b)}
+	digestMu.Unlock()
+	return true
+}
+
+// digestAuth sets the Authorization header of r from the challenge of its
+// protection space, without one r is sent as is to get challenged
+func digestAuth(r *http.Request, username, password string) error {
+	digestMu.Lock()
+	s, ok := digests[digestSpace(r)]
+	digestMu.Unlock()
+	if !ok {
+		return nil
+	}
+	var body []byte
+	if s.challenge.qop() == "auth-int" && r.GetBody != nil {
+		rc, err := r.GetBody()
+		if err != nil {
+			return err
+		}
+		body, err = ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	} else if s.challenge.qop() == "auth-int" && r.Body != nil && r.Body != http.NoBody {
+		return fmt.Errorf("digest qop=auth-int needs a body that can be read twice")
+	}
+	s.mu.Lock()
+	s.nc++
+	nc := s.nc
+	s.mu.Unlock()
+	r.Header.Set("Authorization", s.challenge.authorization(r.Method, r.URL.RequestURI(), body, username, password, s.cnonce, nc))
+	return nil
+}
+
+// qop picks auth over auth-int, "" for a RFC 2069 challenge without qop
+func (c *digestChallenge) qop() string {
+	var qop string
+	for _, q := range c.Qop {
+		switch q {
+		case "auth":
+			return q
+		case "auth-int":
+			qop = q
+		}
+	}
+	return qop
+}
+
+// authorization is the Authorization header of the request number nc with
+// the nonce of c
+func (c *digestChallenge) authorization(method, uri string, body []byte, username, password, cnonce string, nc uint32) string {
+	newHash := digestHash(c.Algorithm)
+	var h = func(s string) string {
+		d := newHash()
+		d.Write([]byte(s))
+		return hex.EncodeToString(d.Sum(nil))
+	}
+
+	qop := c.qop()
+	ncValue := fmt.Sprintf("%08x", nc)
+	ha1 := h(username + ":" + c.Realm + ":" + password)
+	if strings.HasSuffix(strings.ToLower(c.Algorithm), "-sess") {
+		ha1 = h(ha1 + ":" + c.Nonce + ":" + cnonce)
+	}
+	ha2 := h(method + ":" + uri)
+	if qop == "auth-int" {
+		ha2 = h(method + ":" + uri + ":" + h(string(body)))
+	}
+	var response string
+	if qop == "" {
+		response = h(ha1 + ":" + c.Nonce + ":" + ha2)
+	} else {
+		response = h(ha1 + ":" + c.Nonce + ":" + ncValue + ":" + cnonce + ":" + qop + ":" + ha2)
+	}
+
+	if c.Userhash {
+		username = h(username + ":" + c.Realm)
+	}
+	var quote = func(s string) string {
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+	}
+	parts := []string{
+		"username=" + quote(username),
+		"realm=" + quote(c.Realm),
+		"nonce=" + quote(c.Nonce),
+		"uri=" + quote(uri),
+		"algorithm=" + c.Algorithm,
+		"response=" + quote(response),
+	}
+	if c.Opaque != "" {
+		parts = append(parts, "opaque="+quote(c.Opaque))
+	}
+	if qop != "" {
+		parts = append(parts, "qop="+qop, "nc="+ncValue, "cnonce="+quote(cnonce))
+	}
+	if c.Userhash {
+		parts = append(parts, "userhash=true")
+	}
+	return "Digest " + strings.Join(parts, ", ")
+}
+
+// parseAuth parses $auth, [basic:|digest:]user:password
+func parseAuth(value string) (authType, username, password string, err error) {
+	pair := strings.SplitN(value, ":", 3)
+	switch {
+	case (pair[0] == "basic" || pair[0] == "digest") && len(pair) == 3:
+		authType, pair = pair[0], pair[1:]
+	case (pair[0] == "basic" || pair[0] == "digest") && len(pair) == 2:
+		// a scheme and a user without password
+		pair = pair[:1]
+	default:
+		pair = strings.SplitN(value, ":", 2)
+	}
+	if len(pair) < 2 {
+		return "", "", "", fmt.Errorf("$auth=[basic:|digest:]user:password, eg: $auth=digest:admin:secret")
+	}
+	return authType, pair[0], pair[1], nil
+}
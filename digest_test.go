@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDigestAuthorization(t *testing.T) {
+	// RFC 7616 3.9.1
+	c := &digestChallenge{
+		Realm:  "http-auth@example.org",
+		Nonce:  "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v",
+		Opaque: "FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS",
+		Qop:    []string{"auth", "auth-int"},
+	}
+	cases := map[string]string{
+		"MD5":     `response="8ca523f5e9506fed4657c9700eebdbec"`,
+		"SHA-256": `response="753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1"`,
+	}
+	for algorithm, expected := range cases {
+		c.Algorithm = algorithm
+		actual := c.authorization("GET", "/dir/index.html", nil, "Mufasa", "Circle of Life", "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ", 1)
+		if !strings.Contains(actual, expected) || !strings.Contains(actual, "nc=00000001") {
+			t.Errorf("expected %v, actual %v", expected, actual)
+		}
+	}
+}
+
+func TestParseDigest(t *testing.T) {
+	c, err := parseDigest([]string{
+		`Basic realm="x", Digest realm="api", qop="auth, auth-int", algorithm=MD5, nonce="n1", opaque="o"`,
+		`Digest realm="api", qop="auth", algorithm=SHA-256-sess, nonce="n2", stale=TRUE`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Algorithm != "SHA-256-sess" || c.Nonce != "n2" || !c.Stale || c.qop() != "auth" {
+		t.Errorf("expected %v, actual %+v", "SHA-256-sess n2 stale auth", c)
+	}
+	if _, err = parseDigest([]string{`Basic realm="x"`}); err == nil {
+		t.Errorf("expected error, actual nil")
+	}
+}
+
+func TestParseAuth(t *testing.T) {
+	cases := map[string][3]string{
+		"u:p":          {"", "u", "p"},
+		"u:p:q":        {"", "u", "p:q"},
+		"digest:u:p:q": {"digest", "u", "p:q"},
+		"basic:u:p":    {"basic", "u", "p"},
+	}
+	for _, in := range []string{"digest:u", "basic:u", "u"} {
+		if _, _, _, err := parseAuth(in); err == nil {
+			t.Errorf("%s expected error, actual nil", in)
+		}
+	}
+	for in, expected := range cases {
+		authType, username, password, err := parseAuth(in)
+		actual := [3]string{authType, username, password}
+		if err != nil || actual != expected {
+			t.Errorf("expected %v, actual %v %v", expected, actual, err)
+		}
+	}
+}
+
+func TestDigestNonceCount(t *testing.T) {
+	var auths []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if auth == "" {
+			w.Header().Set("WWW-Authenticate", `Digest realm="test", qop="auth", nonce="abc", algorithm=SHA-256`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		auths = append(auths, auth)
+	}))
+	defer ts.Close()
+
+	r, _ := http.NewRequest("GET", ts.URL+"/a?b=1", nil)
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if !digestChallenged(r, resp) {
+		t.Fatalf("expected %v, actual %v", true, false)
+	}
+	for i := 0; i < 2; i++ {
+		r, _ = http.NewRequest("GET", ts.URL+"/a?b=1", nil)
+		if err = digestAuth(r, "u", "p"); err != nil {
+			t.Fatal(err)
+		}
+		if resp, err = http.DefaultClient.Do(r); err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	// refused without stale, the session is dropped for a new challenge
+	resp.Header = http.Header{"Www-Authenticate": {`Digest realm="test", qop="auth", nonce="def"`}}
+	if digestChallenged(r, resp) {
+		t.Errorf("expected %v, actual %v", false, true)
+	}
+	if _, ok := digests[digestSpace(r)]; ok {
+		t.Errorf("expected %v, actual %v", false, ok)
+	}
+	if len(auths) != 2 || !strings.Contains(auths[0], "nc=00000001") || !strings.Contains(auths[1], "nc=00000002") ||
+		!strings.Contains(auths[1], `uri="/a?b=1"`) {
+		t.Errorf("expected %v, actual %v", "nc=00000001 then nc=00000002", auths)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const envFile = "environments.json"
+
+var (
+	environments   = make(map[string]*Environment)
+	activeEnv      string
+	regPlaceholder = regexp.MustCompile(`{{\s*([^{}\s]+)\s*}}`)
+)
+
+// Environment is a named set of variables referenced as {{name}}
+type Environment struct {
+	Vars map[string]string `json:"vars"`
+	TLS  *TLSOptions       `json:"tls,omitempty"`
+	// PersistCookies saves the cookie jar of the environment to disk
+	PersistCookies bool `json:"persist_cookies,omitempty"`
+	// OAuth are the OAuth 2.0 profiles used by $oauth=name
+	OAuth map[string]*OAuthProfile `json:"oauth,omitempty"`
+}
+
+func loadEnvironments() {
+	content, err := ioutil.ReadFile(envFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Println("Read file", envFile, err)
+		}
+		return
+	}
+	if err = json.Unmarshal(content, &environments); err != nil {
+		fmt.Println("Unmarshal", envFile, err)
+		return
+	}
+	for name, e := range environments {
+		if e.Vars == nil {
+			e.Vars = make(map[string]string)
+		}
+		suggest.AddSuggest(name)
+		for k := range e.Vars {
+			suggest.AddSuggest("{{" + k + "}}")
+		}
+	}
+}
+
+func saveEnvironments() {
+	b, err := json.MarshalIndent(environments, "", "  ")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	// secrets are kept here, WriteFile leaves the mode of an existing file
+	if err = ioutil.WriteFile(envFile, b, 0600); err != nil {
+		fmt.Println(err)
+		return
+	}
+	os.Chmod(envFile, 0600)
+}
+
+// lookupVar returns the value of name in the current script block, the
+// captured session variables or the active environment
+func lookupVar(name string) (string, bool) {
+	if v, ok := blockVars[name]; ok {
+		return v, true
+	}
+	if v, ok := sessionVars[name]; ok {
+		return v, true
+	}
+	if e, ok := environments[activeEnv]; ok {
+		v, ok := e.Vars[name]
+		return v, ok
+	}
+	return "", false
+}
+
+// expand replaces {{name}} placeholders, unknown names are left untouched
+func expand(s string) string {
+	if !strings.Contains(s, "{{") {
+		return s
+	}
+	return regPlaceholder.ReplaceAllStringFunc(s, func(m string) string {
+		name := regPlaceholder.FindStringSubmatch(m)[1]
+		if v, ok := lookupVar(name); ok {
+			return v
+		}
+		return m
+	})
+}
+
+// validEnvName reports whether name can name the cookie and token files of
+// an environment
+func validEnvName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+// env            list environments
+// env <name>     switch the active environment, `env -` to deactivate
+func envCommand(args []string) {
+	if len(args) == 0 {
+		names := make([]string, 0, len(environments))
+		for name := range environments {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			mark := " "
+			if name == activeEnv {
+				mark = "*"
+			}
+			fmt.Println(mark, name)
+		}
+		if e, ok := environments[activeEnv]; ok {
+			printVars(e.Vars)
+			if e.TLS != nil {
+				printVars(e.TLS.vars())
+			}
+		}
+		if len(sessionVars) > 0 {
+			fmt.Println("  session")
+			printVars(sessionVars)
+		}
+		return
+	}
+
+	name := args[0]
+	if name == "-" {
+		activeEnv = ""
+	} else {
+		if _, ok := environments[name]; !ok && !validEnvName(name) {
+			fmt.Printf("`%s` has path separators, the name of an environment names its files\n", name)
+			return
+		}
+		if _, ok := environments[name]; !ok {
+			environments[name] = &Environment{Vars: make(map[string]string)}
+			fmt.Printf("> Create environment `%s`\n", name)
+		}
+		activeEnv = name
+		suggest.AddSuggest(name)
+	}
+	changePrefix()
+}
+
+// set <key>=<value>...   set variables in the active environment
+func setCommand(args []string) {
+	e, ok := environments[activeEnv]
+	if !ok {
+		fmt.Println("No active environment, use `env <name>` first")
+		return
+	}
+	for _, arg := range args {
+		pair := strings.SplitN(arg, "=", 2)
+		if isTLSVariable(pair[0]) {
+			if e.TLS == nil {
+				e.TLS = &TLSOptions{}
+			}
+			pair = append(pair, "")
+			if err := e.TLS.set(pair[0], pair[1]); err != nil {
+				fmt.Println(err)
+				return
+			}
+			continue
+		}
+		if len(pair) != 2 || pair[0] == "" {
+			fmt.Println("set <key>=<value>, eg: set host=localhost:8080")
+			return
+		}
+		e.Vars[pair[0]] = pair[1]
+		suggest.AddSuggest("{{" + pair[0] + "}}")
+	}
+	saveEnvironments()
+}
+
+// unset <key>...   remove variables from the active environment
+func unsetCommand(args []string) {
+	e, ok := environments[activeEnv]
+	if !ok {
+		fmt.Println("No active environment, use `env <name>` first")
+		return
+	}
+	for _, k := range args {
+		if isTLSVariable(k) && e.TLS != nil {
+			v := ""
+			if k == "$insecure" {
+				v = "false"
+			}
+			e.TLS.set(k, v)
+			if e.TLS.empty() {
+				e.TLS = nil
+			}
+			continue
+		}
+		delete(e.Vars, k)
+	}
+	saveEnvironments()
+}
+
+func printVars(vars map[string]string) {
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Printf("    %s = %s\n", k, vars[k])
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestPlaceholdersKept(t *testing.T) {
+	oldEnvs, oldActive, oldReq, oldInteractive := environments, activeEnv, req, interactive
+	defer func() { environments, activeEnv, req, interactive = oldEnvs, oldActive, oldReq, oldInteractive }()
+	environments = map[string]*Environment{
+		"dev":  {Vars: map[string]string{"host": "dev.local", "token": "d"}},
+		"prod": {Vars: map[string]string{"host": "api.example.com", "token": "p"}},
+	}
+	activeEnv = "dev"
+	req = newReq()
+	interactive = false
+	parseInput("POST {{host}}/users X-Token:{{token}} name={{token}} $auth=u:{{token}}")
+
+	d := req.data()
+	if d.URL != "http://{{host}}/users" || d.Header.Get("X-Token") != "{{token}}" || d.Fields.Get("name") != "{{token}}" || d.Password != "{{token}}" {
+		t.Errorf("expected placeholders, actual %s %v %v %s", d.URL, d.Header, d.Fields, d.Password)
+	}
+	if req.URL.Host != "dev.local" {
+		t.Errorf("expected %s, actual %s", "dev.local", req.URL.Host)
+	}
+
+	activeEnv = "prod"
+	httpReq, err := req.newHTTPRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if httpReq.URL.String() != "http://api.example.com/users" || httpReq.Header.Get("X-Token") != "p" {
+		t.Errorf("expected %s, actual %s %v", "http://api.example.com/users p", httpReq.URL, httpReq.Header)
+	}
+	if _, password, _ := httpReq.BasicAuth(); password != "p" {
+		t.Errorf("expected %s, actual %s", "p", password)
+	}
+
+	parseInput("/orders")
+	if req.RawURL != "http://{{host}}/orders" {
+		t.Errorf("expected %s, actual %s", "http://{{host}}/orders", req.RawURL)
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var exporters = map[string]func(e *exportRequest) string{
+	"curl":   exportCurl,
+	"httpie": exportHTTPie,
+	"go":     exportGo,
+	"python": exportPython,
+}
+
+// exportRequest is the fully built request, Files and Fields are set for
+// multipart requests whose body is rendered by each format itself
+type exportRequest struct {
+	Method string
+	URL    string
+	Header http.Header
+	Body   []byte
+	Files  [][2]string
+	Fields [][2]string
+}
+
+// export <curl|httpie|go|python> [file]
+func exportCommand(args []string) {
+	if len(args) == 0 || len(args) > 2 || exporters[args[0]] == nil {
+		fmt.Println("export <curl|httpie|go|python> [file]")
+		return
+	}
+	e, err := newExportRequest(req)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	out := exporters[args[0]](e)
+	if len(args) == 1 {
+		fmt.Println(out)
+		return
+	}
+	if err = ioutil.WriteFile(args[1], []byte(out+"\n"), 0644); err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("> Export to `%s`\n", args[1])
+}
+
+func newExportRequest(r *Request) (*exportRequest, error) {
+	// build from a copy, newHTTPRequest consumes JSONMap
+	c, err := r.data().request()
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := c.newHTTPRequest()
+	if err != nil {
+		return nil, err
+	}
+	e := &exportRequest{Method: httpReq.Method, URL: httpReq.URL.String(), Header: httpReq.Header}
+	multipart := strings.HasPrefix(httpReq.Header.Get("Content-Type"), "multipart/form-data")
+	if httpReq.Body != nil {
+		if multipart {
+			io.Copy(ioutil.Discard, httpReq.Body)
+		} else {
+			e.Body, _ = ioutil.ReadAll(httpReq.Body)
+		}
+		httpReq.Body.Close()
+	}
+	if multipart {
+		e.Header.Del("Content-Type")
+		for _, k := range sortedKeys(c.Files) {
+			for _, v := range c.Files[k] {
+				e.Files = append(e.Files, [2]string{k, v})
+			}
+		}
+		for _, k := range sortedKeys(c.Fields) {
+			for _, v := range c.Fields[k] {
+				e.Fields = append(e.Fields, [2]string{k, v})
+			}
+		}
+	}
+	return e, nil
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// shellQuote quotes s for POSIX shells
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(c rune) bool {
+		return !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-_./:@%+=,", c))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+func exportCurl(e *exportRequest) string {
+	var buf bytes.Buffer
+	buf.WriteString("curl")
+	if e.Method != GET || e.Body != nil {
+		buf.WriteString(" -X " + e.Method)
+	}
+	buf.WriteString(" " + shellQuote(e.URL))
+	for _, k := range sortedKeys(e.Header) {
+		for _, v := range e.Header[k] {
+			buf.WriteString(" \\\n  -H " + shellQuote(k+": "+v))
+		}
+	}
+	for _, f := range e.Fields {
+		buf.WriteString(" \\\n  --form-string " + shellQuote(f[0]+"="+f[1]))
+	}
+	for _, f := range e.Files {
+		buf.WriteString(" \\\n  -F " + shellQuote(f[0]+"=@"+f[1]))
+	}
+	if len(e.Body) > 0 {
+		buf.WriteString(" \\\n  --data-binary " + shellQuote(string(e.Body)))
+	}
+	return buf.String()
+}
+
+func exportHTTPie(e *exportRequest) string {
+	var buf bytes.Buffer
+	buf.WriteString("http")
+	if len(e.Files) > 0 || len(e.Fields) > 0 {
+		buf.WriteString(" --multipart")
+	}
+	buf.WriteString(" " + e.Method + " " + shellQuote(e.URL))
+	for _, k := range sortedKeys(e.Header) {
+		for _, v := range e.Header[k] {
+			buf.WriteString(" \\\n  " + shellQuote(k+":"+v))
+		}
+	}
+	for _, f := range e.Fields {
+		buf.WriteString(" \\\n  " + shellQuote(f[0]+"="+f[1]))
+	}
+	for _, f := range e.Files {
+		buf.WriteString(" \\\n  " + shellQuote(f[0]+"@"+f[1]))
+	}
+	if len(e.Body) > 0 {
+		buf.WriteString(" \\\n  --raw " + shellQuote(string(e.Body)))
+	}
+	return buf.String()
+}
+
+func exportGo(e *exportRequest) string {
+	var buf bytes.Buffer
+	multipart := len(e.Files) > 0 || len(e.Fields) > 0
+	buf.WriteString("package main\n\nimport (\n")
+	if multipart {
+		buf.WriteString("\t\"bytes\"\n")
+	}
+	buf.WriteString("\t\"fmt\"\n\t\"io\"\n")
+	if multipart {
+		buf.WriteString("\t\"mime/multipart\"\n")
+	}
+	buf.WriteString("\t\"net/http\"\n")
+	if len(e.Files) > 0 {
+		buf.WriteString("\t\"os\"\n")
+	} else if !multipart && len(e.Body) > 0 {
+		buf.WriteString("\t\"strings\"\n")
+	}
+	buf.WriteString(")\n\nfunc main() {\n")
+
+	body := "nil"
+	if multipart {
+		body = "body"
+		buf.WriteString("\tbody := &bytes.Buffer{}\n\tw := multipart.NewWriter(body)\n")
+		for _, f := range e.Fields {
+			fmt.Fprintf(&buf, "\tw.WriteField(%s, %s)\n", strconv.Quote(f[0]), strconv.Quote(f[1]))
+		}
+		for _, f := range e.Files {
+			fmt.Fprintf(&buf, "\tif f, err := os.Open(%s); err == nil {\n", strconv.Quote(f[1]))
+			fmt.Fprintf(&buf, "\t\tfw, _ := w.CreateFormFile(%s, %s)\n", strconv.Quote(f[0]), strconv.Quote(f[1]))
+			buf.WriteString("\t\tio.Copy(fw, f)\n\t\tf.Close()\n\t}\n")
+		}
+		buf.WriteString("\tw.Close()\n\n")
+	} else if len(e.Body) > 0 {
+		body = "body"
+		fmt.Fprintf(&buf, "\tbody := strings.NewReader(%s)\n", strconv.Quote(string(e.Body)))
+	}
+	fmt.Fprintf(&buf, "\treq, err := http.NewRequest(%s, %s, %s)\n", strconv.Quote(e.Method), strconv.Quote(e.URL), body)
+	buf.WriteString("\tif err != nil {\n\t\tpanic(err)\n\t}\n")
+	for _, k := range sortedKeys(e.Header) {
+		for _, v := range e.Header[k] {
+			fmt.Fprintf(&buf, "\treq.Header.Add(%s, %s)\n", strconv.Quote(k), strconv.Quote(v))
+		}
+	}
+	if multipart {
+		buf.WriteString("\treq.Header.Set(\"Content-Type\", w.FormDataContentType())\n")
+	}
+	buf.WriteString(`
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		panic(err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	fmt.Println(resp.Status)
+	fmt.Println(string(b))
+}`)
+	return buf.String()
+}
+
+func exportPython(e *exportRequest) string {
+	var buf bytes.Buffer
+	buf.WriteString("import requests\n\n")
+	buf.WriteString("headers = {\n")
+	for _, k := range sortedKeys(e.Header) {
+		fmt.Fprintf(&buf, "    %s: %s,\n", strconv.Quote(k), strconv.Quote(strings.Join(e.Header[k], ", ")))
+	}
+	buf.WriteString("}\n")
+	args := "headers=headers"
+	// fields go with the files as (None, value), requests sends data alone
+	// urlencoded
+	if len(e.Files) > 0 || len(e.Fields) > 0 {
+		buf.WriteString("files = [\n")
+		for _, f := range e.Fields {
+			fmt.Fprintf(&buf, "    (%s, (None, %s)),\n", strconv.Quote(f[0]), strconv.Quote(f[1]))
+		}
+		for _, f := range e.Files {
+			fmt.Fprintf(&buf, "    (%s, open(%s, \"rb\")),\n", strconv.Quote(f[0]), strconv.Quote(f[1]))
+		}
+		buf.WriteString("]\n")
+		args += ", files=files"
+	}
+	if len(e.Body) > 0 {
+		fmt.Fprintf(&buf, "data = %s\n", strconv.Quote(string(e.Body)))
+		args += ", data=data.encode(\"utf-8\")"
+	}
+	fmt.Fprintf(&buf, "\nresp = requests.request(%s, %s, %s)\n", strconv.Quote(e.Method), strconv.Quote(e.URL), args)
+	buf.WriteString("print(resp.status_code)\nprint(resp.text)")
+	return buf.String()
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func testExportFields(t *testing.T) *exportRequest {
+	r, err := parseCurl(`curl a.com/profile -F name=x`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := newExportRequest(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestExportGoFields(t *testing.T) {
+	out := exportGo(testExportFields(t))
+	if strings.Contains(out, `"os"`) || !strings.Contains(out, `w.WriteField("name", "x")`) {
+		t.Errorf("expected %s, actual %s", `WriteField without "os"`, out)
+	}
+}
+
+func TestExportPythonFields(t *testing.T) {
+	out := exportPython(testExportFields(t))
+	if !strings.Contains(out, `("name", (None, "x"))`) || !strings.Contains(out, "files=files") || strings.Contains(out, "data=") {
+		t.Errorf("expected %s, actual %s", "files=files", out)
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/csv"
+	"fmt"
+	"math"
+	mrand "math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+var gen = &generator{csv: make(map[string]*csvFile)}
+
+// generator expands {{$name:args}} placeholders with a new value on every
+// send, the iteration number makes all values of one request consistent
+//
+//	{{$seq}}                  1, 2, 3...
+//	{{$randInt:1:100}}        random integer in [1, 100]
+//	{{$randString:8}}         random alphanumeric string
+//	{{$uuid}}                 random UUID v4
+//	{{$timestamp}}            unix seconds, {{$timestampMs}} milliseconds
+//	{{$isoTimestamp}}         RFC 3339 time
+//	{{$csv:users.csv:name}}   column of the CSV row of this iteration
+type generator struct {
+	seq uint64
+	mu  sync.Mutex
+	csv map[string]*csvFile
+}
+
+type csvFile struct {
+	header []string
+	rows   [][]string
+}
+
+func (g *generator) next() uint64 {
+	return atomic.AddUint64(&g.seq, 1)
+}
+
+func (g *generator) expand(s string, seq uint64) (string, error) {
+	if !strings.Contains(s, "{{") {
+		return s, nil
+	}
+	var err error
+	s = regPlaceholder.ReplaceAllStringFunc(s, func(m string) string {
+		name := regPlaceholder.FindStringSubmatch(m)[1]
+		if !strings.HasPrefix(name, "$") {
+			return m
+		}
+		v, e := g.value(strings.Split(name[1:], ":"), seq)
+		if e != nil {
+			err = e
+			return m
+		}
+		return v
+	})
+	return s, err
+}
+
+func (g *generator) value(args []string, seq uint64) (string, error) {
+	switch args[0] {
+	case "seq":
+		return strconv.FormatUint(seq, 10), nil
+	case "randInt":
+		min, max := int64(0), int64(1000000)
+		if len(args) == 3 {
+			var err1, err2 error
+			min, err1 = strconv.ParseInt(args[1], 10, 64)
+			max, err2 = strconv.ParseInt(args[2], 10, 64)
+			if err1 != nil || err2 != nil || max < min {
+				return "", fmt.Errorf("{{$randInt:min:max}}, eg: {{$randInt:1:100}}")
+			}
+			// max-min+1 has to fit Int63n
+			if span := max - min; span < 0 || span == math.MaxInt64 {
+				return "", fmt.Errorf("{{$randInt:%d:%d}} range is too wide", min, max)
+			}
+		}
+		return strconv.FormatInt(min+mrand.Int63n(max-min+1), 10), nil
+	case "randString":
+		n := 8
+		if len(args) == 2 {
+			var err error
+			if n, err = strconv.Atoi(args[1]); err != nil || n < 0 {
+				return "", fmt.Errorf("{{$randString:length}}, eg: {{$randString:8}}")
+			}
+		}
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = letters[mrand.Intn(len(letters))]
+		}
+		return string(b), nil
+	case "uuid":
+		var b [16]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			return "", err
+		}
+		b[6] = b[6]&0x0f | 0x40
+		b[8] = b[8]&0x3f | 0x80
+		return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+	case "timestamp":
+		return strconv.FormatInt(time.Now().Unix(), 10), nil
+	case "timestampMs":
+		return strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10), nil
+	case "isoTimestamp":
+		return time.Now().Format(time.RFC3339), nil
+	case "csv":
+		if len(args) < 2 {
+			return "", fmt.Errorf("{{$csv:file[:column]}}, eg: {{$csv:users.csv:name}}")
+		}
+		f, err := g.loadCSV(args[1])
+		if err != nil {
+			return "", err
+		}
+		row := f.rows[(seq-1)%uint64(len(f.rows))]
+		col := 0
+		if len(args) > 2 {
+			col = -1
+			for i, h := range f.header {
+				if h == args[2] {
+					col = i
+				}
+			}
+			if col < 0 {
+				if col, err = strconv.Atoi(args[2]); err != nil {
+					return "", fmt.Errorf("column `%s` not found in %s", args[2], args[1])
+				}
+			}
+		}
+		if col < 0 || col >= len(row) {
+			return "", fmt.Errorf("column `%s` out of range in %s", args[2], args[1])
+		}
+		return row[col], nil
+	}
+	return "", fmt.Errorf("unknown generator `$%s`", args[0])
+}
+
+// loadCSV reads filename once, its first line is the header
+func (g *generator) loadCSV(filename string) (*csvFile, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if f, ok := g.csv[filename]; ok {
+		return f, nil
+	}
+	fd, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	records, err := csv.NewReader(fd).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) < 2 {
+		return nil, fmt.Errorf("%s has no rows", filename)
+	}
+	f := &csvFile{header: records[0], rows: records[1:]}
+	g.csv[filename] = f
+	return f, nil
+}
+
+// expandWith returns d with f applied to the URL, credentials, proxy,
+// body, headers, values, fields, files and JSON strings
+func (d RequestData) expandWith(f func(string) string) RequestData {
+	var expandValues = func(m map[string][]string) map[string][]string {
+		c := make(map[string][]string, len(m))
+		for k, v := range m {
+			l := make([]string, len(v))
+			for i := range v {
+				l[i] = f(v[i])
+			}
+			c[f(k)] = l
+		}
+		return c
+	}
+	var expandJSON func(v interface{}) interface{}
+	expandJSON = func(v interface{}) interface{} {
+		switch x := v.(type) {
+		case string:
+			return f(x)
+		case []interface{}:
+			l := make([]interface{}, len(x))
+			for i := range x {
+				l[i] = expandJSON(x[i])
+			}
+			return l
+		case map[string]interface{}:
+			m := make(map[string]interface{}, len(x))
+			for k, v := range x {
+				m[k] = expandJSON(v)
+			}
+			return m
+		}
+		return v
+	}
+
+	// url.URL escapes the braces of placeholders in the path
+	d.URL = f(strings.NewReplacer("%7B%7B", "{{", "%7D%7D", "}}").Replace(d.URL))
+	d.Username = f(d.Username)
+	d.Password = f(d.Password)
+	d.Proxy = f(d.Proxy)
+	d.Body = f(d.Body)
+	d.Header = expandValues(d.Header)
+	d.Values = expandValues(d.Values)
+	d.Fields = expandValues(d.Fields)
+	d.Files = expandValues(d.Files)
+	jsonMap := make(map[string][]interface{}, len(d.JSONMap))
+	for k, v := range d.JSONMap {
+		l := make([]interface{}, len(v))
+		for i := range v {
+			l[i] = expandJSON(v[i])
+		}
+		jsonMap[k] = l
+	}
+	d.JSONMap = jsonMap
+	return d
+}
+
+// buildRequest expands the generators of d for iteration seq and builds
+// a new authorized http request, d itself is left untouched. login allows
+// the browser login of an OAuth profile.
+func buildRequest(d RequestData, seq uint64, login bool) (*http.Request, error) {
+	var err error
+	d = d.expandWith(func(s string) string {
+		v, e := gen.expand(s, seq)
+		if e != nil && err == nil {
+			err = e
+		}
+		return v
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := d.request()
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := r.newHTTPRequest()
+	if err != nil {
+		return nil, err
+	}
+	if err = r.authorize(httpReq, login); err != nil {
+		return nil, err
+	}
+	return httpReq, nil
+}
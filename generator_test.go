@@ -0,0 +1,57 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestGenerator(t *testing.T) {
+	g := &generator{csv: make(map[string]*csvFile)}
+	dir, _ := ioutil.TempDir("", "httpgo")
+	defer os.RemoveAll(dir)
+	f := filepath.Join(dir, "users.csv")
+	ioutil.WriteFile(f, []byte("name,age\nann,3\nbob,4\n"), 0644)
+
+	cases := []struct {
+		in   string
+		seq  uint64
+		want string
+	}{
+		{"/users/{{$seq}}", 7, "/users/7"},
+		{"{{$csv:" + f + ":name}}-{{$csv:" + f + ":age}}", 1, "ann-3"},
+		{"{{$csv:" + f + ":name}}", 4, "bob"},
+		{"{{$csv:" + f + ":1}}", 2, "4"},
+		{"{{host}}", 1, "{{host}}"},
+	}
+	for _, c := range cases {
+		actual, err := g.expand(c.in, c.seq)
+		if err != nil || actual != c.want {
+			t.Errorf("expected %v, actual %v %v", c.want, actual, err)
+		}
+	}
+
+	patterns := map[string]string{
+		"{{$randInt:1:1}}":   `^1$`,
+		"{{$randString:12}}": `^[a-zA-Z0-9]{12}$`,
+		"{{$uuid}}":          `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`,
+		"{{$timestamp}}":     `^\d{10}$`,
+	}
+	for in, p := range patterns {
+		actual, err := g.expand(in, 1)
+		if err != nil || !regexp.MustCompile(p).MatchString(actual) {
+			t.Errorf("expected %v, actual %v %v", p, actual, err)
+		}
+	}
+
+	for _, in := range []string{"{{$nope}}", "{{$randInt:2:1}}", "{{$randInt:-9223372036854775808:9223372036854775807}}", "{{$randInt:-1:9223372036854775807}}"} {
+		if _, err := g.expand(in, 1); err == nil {
+			t.Errorf("%s expected error, actual nil", in)
+		}
+	}
+	if _, err := g.expand("{{$randInt:0:9223372036854775806}}", 1); err != nil {
+		t.Errorf("expected nil, actual %v", err)
+	}
+}
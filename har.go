@@ -0,0 +1,370 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// HAR 1.2, http://www.softwareishard.com/blog/har-12-spec/
+type har struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string     `json:"mimeType"`
+	Text     string     `json:"text,omitempty"`
+	Params   []harParam `json:"params,omitempty"`
+}
+
+type harParam struct {
+	Name     string `json:"name"`
+	Value    string `json:"value,omitempty"`
+	FileName string `json:"fileName,omitempty"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type harTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+// har export <file>
+// har import <file>
+func harCommand(args []string) {
+	if len(args) != 2 {
+		fmt.Println("har export|import <file>")
+		return
+	}
+	switch args[0] {
+	case "export":
+		exportHAR(args[1])
+	case "import":
+		importHAR(args[1])
+	default:
+		fmt.Println("har export|import <file>")
+	}
+}
+
+func exportHAR(filename string) {
+	h := har{Log: harLog{Version: "1.2", Creator: harCreator{Name: "httpgo", Version: "0.1"}}}
+	for _, e := range histories {
+		entry, err := newHAREntry(e)
+		if err != nil {
+			fmt.Println(e, err)
+			continue
+		}
+		h.Log.Entries = append(h.Log.Entries, entry)
+	}
+	b, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if err = ioutil.WriteFile(filename, b, 0644); err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("> Export %d entries to `%s`\n", len(h.Log.Entries), filename)
+}
+
+// newHAREntry builds the entry from the saved request data, it does not go
+// through newHTTPRequest which opens files and authorizes the request
+func newHAREntry(e HistoryEntry) (harEntry, error) {
+	// the URL and header as sent, expanding the request again takes the
+	// environment of the export
+	d := e.Request
+	if e.URL != "" {
+		d.URL, d.Values = e.URL, nil
+	}
+	if e.Header != nil {
+		d.Header = e.Header
+	}
+	r, err := d.expandWith(expand).request()
+	if err != nil {
+		return harEntry{}, err
+	}
+	if r.URL == nil {
+		return harEntry{}, fmt.Errorf("URL not set")
+	}
+	rawURL := r.URL.String()
+	if len(r.Values) > 0 {
+		rawURL += "?" + r.Values.Encode()
+	}
+	query := r.URL.Query()
+	for k, v := range r.Values {
+		query[k] = append(query[k], v...)
+	}
+	header := r.Header.Clone()
+	if header.Get("Content-Type") == "" {
+		header.Set("Content-Type", "application/json; charset=UTF-8")
+	}
+	if header.Get("Accept") == "" {
+		header.Set("Accept", "application/json")
+	}
+	if r.Username != "" && r.AuthType != "digest" {
+		header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(r.Username+":"+r.Password)))
+	}
+	proto := e.Proto
+	if proto == "" {
+		proto = "HTTP/1.1"
+	}
+
+	ms := float64(e.Duration) / float64(time.Millisecond)
+	entry := harEntry{
+		StartedDateTime: e.Time,
+		Time:            ms,
+		Request: harRequest{
+			Method:      r.Method,
+			URL:         rawURL,
+			HTTPVersion: proto,
+			Cookies:     []harNameValue{},
+			QueryString: harValues(query),
+			HeadersSize: -1,
+		},
+		Response: harResponse{
+			Status:      e.Status,
+			StatusText:  http.StatusText(e.Status),
+			HTTPVersion: proto,
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(e.ResponseHeader),
+			Content: harContent{
+				Size:     len(e.ResponseBody),
+				MimeType: e.ResponseHeader.Get("Content-Type"),
+				Text:     e.ResponseBody,
+			},
+			RedirectURL: e.ResponseHeader.Get("Location"),
+			HeadersSize: -1,
+			BodySize:    len(e.ResponseBody),
+		},
+		Timings: harTimings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1, Wait: ms},
+	}
+	if t := e.Timing; t != nil {
+		var msOf = func(d time.Duration) float64 {
+			return float64(d) / float64(time.Millisecond)
+		}
+		entry.Timings.Wait, entry.Timings.Receive = msOf(t.Wait), msOf(t.Transfer)
+		// a reused connection has no dns, connect and ssl phases, HAR
+		// counts ssl in connect
+		if !t.Reused {
+			entry.Timings.DNS, entry.Timings.Connect = msOf(t.DNS), msOf(t.Connect+t.TLS)
+			if t.TLS > 0 {
+				entry.Timings.SSL = msOf(t.TLS)
+			}
+		}
+	}
+	if !utf8.ValidString(e.ResponseBody) {
+		entry.Response.Content.Text = base64.StdEncoding.EncodeToString([]byte(e.ResponseBody))
+		entry.Response.Content.Encoding = "base64"
+	}
+
+	// the same body as newHTTPRequest
+	var body string
+	if r.Method == POST || r.Method == PUT || r.Method == PATCH {
+		switch {
+		case r.Body.Len() > 0:
+			body = r.Body.String()
+		case len(r.JSONMap) > 0 && r.JSON:
+			b, _ := ioutil.ReadAll(r.jsonBody())
+			body = string(b)
+		case len(r.Files) > 0 || r.Multipart:
+			header.Set("Content-Type", "multipart/form-data")
+			pd := &harPostData{MimeType: "multipart/form-data"}
+			for _, k := range sortedKeys(r.Fields) {
+				for _, v := range r.Fields[k] {
+					pd.Params = append(pd.Params, harParam{Name: k, Value: v})
+				}
+			}
+			for _, k := range sortedKeys(r.Files) {
+				for _, v := range r.Files[k] {
+					pd.Params = append(pd.Params, harParam{Name: k, FileName: v})
+				}
+			}
+			entry.Request.PostData = pd
+			entry.Request.BodySize = -1
+		case len(r.Fields) > 0 && r.JSON:
+			b, _ := ioutil.ReadAll(r.jsonBody())
+			body = string(b)
+		case len(r.Fields) > 0:
+			header.Set("Content-Type", "application/x-www-form-urlencoded")
+			body = r.Fields.Encode()
+		}
+	}
+	if body != "" {
+		entry.Request.PostData = &harPostData{MimeType: header.Get("Content-Type"), Text: body}
+		entry.Request.BodySize = len(body)
+	}
+	entry.Request.Headers = harHeaders(header)
+	return entry, nil
+}
+
+func harHeaders(h http.Header) []harNameValue {
+	l := []harNameValue{}
+	for _, k := range sortedKeys(h) {
+		for _, v := range h[k] {
+			l = append(l, harNameValue{Name: k, Value: v})
+		}
+	}
+	return l
+}
+
+func harValues(q url.Values) []harNameValue {
+	l := []harNameValue{}
+	for _, k := range sortedKeys(q) {
+		for _, v := range q[k] {
+			l = append(l, harNameValue{Name: k, Value: v})
+		}
+	}
+	return l
+}
+
+func importHAR(filename string) {
+	content := readFile(filename)
+	if len(content) == 0 {
+		return
+	}
+	var h har
+	if err := json.Unmarshal(content, &h); err != nil {
+		fmt.Println("Unmarshal", filename, err)
+		return
+	}
+	var items []HistoryEntry
+	for _, entry := range h.Log.Entries {
+		e, err := historyFromHAR(entry)
+		if err != nil {
+			fmt.Println(entry.Request.URL, err)
+			continue
+		}
+		items = append(items, e)
+		histories = append(histories, e)
+		suggest.AddSuggest(e.Request.URL)
+	}
+	if len(histories) > maxHistory {
+		histories = histories[len(histories)-maxHistory:]
+	}
+	fmt.Printf("> Import %d entries from `%s`\n", len(items), filename)
+	if len(items) > 0 {
+		histSelect(items, true)
+	}
+}
+
+func historyFromHAR(entry harEntry) (HistoryEntry, error) {
+	u, err := url.Parse(entry.Request.URL)
+	if err != nil {
+		return HistoryEntry{}, err
+	}
+	d := RequestData{
+		Method: strings.ToUpper(entry.Request.Method),
+		JSON:   true,
+		Header: make(http.Header),
+		Values: u.Query(),
+		Fields: make(url.Values),
+	}
+	u.RawQuery = ""
+	u.Fragment = ""
+	d.URL = u.String()
+	for _, h := range entry.Request.Headers {
+		// HTTP/2 pseudo headers and headers net/http sets by itself, the
+		// br and zstd of browsers would turn off its gzip decoding
+		if strings.HasPrefix(h.Name, ":") || strings.EqualFold(h.Name, "Content-Length") || strings.EqualFold(h.Name, "Host") ||
+			strings.EqualFold(h.Name, "Accept-Encoding") {
+			continue
+		}
+		d.Header.Add(h.Name, h.Value)
+	}
+	if pd := entry.Request.PostData; pd != nil {
+		if strings.HasPrefix(pd.MimeType, "application/x-www-form-urlencoded") && len(pd.Params) > 0 {
+			d.JSON = false
+			d.Form = true
+			for _, p := range pd.Params {
+				d.Fields.Add(p.Name, p.Value)
+			}
+		} else if pd.Text != "" {
+			d.Body = pd.Text
+		}
+	}
+
+	e := HistoryEntry{
+		Time:           entry.StartedDateTime,
+		Request:        d,
+		Proto:          entry.Response.HTTPVersion,
+		Status:         entry.Response.Status,
+		ResponseHeader: make(http.Header),
+		ResponseBody:   entry.Response.Content.Text,
+		Duration:       time.Duration(entry.Time * float64(time.Millisecond)),
+	}
+	for _, h := range entry.Response.Headers {
+		e.ResponseHeader.Add(h.Name, h.Value)
+	}
+	if entry.Response.Content.Encoding == "base64" {
+		if b, err := base64.StdEncoding.DecodeString(e.ResponseBody); err == nil {
+			e.ResponseBody = string(b)
+		}
+	}
+	return e, nil
+}
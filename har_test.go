@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestNewHAREntry(t *testing.T) {
+	e := HistoryEntry{
+		Request: RequestData{
+			Method: POST,
+			URL:    "http://a.com/upload",
+			OAuth:  "missing",
+			Header: make(http.Header),
+			Fields: url.Values{"name": {"x"}},
+			Files:  url.Values{"file": {"/does/not/exist.png"}},
+		},
+		Status:         200,
+		ResponseHeader: http.Header{"Content-Type": {"image/png"}},
+		ResponseBody:   "\x89PNG\r\n\x1a\n\xff",
+	}
+	entry, err := newHAREntry(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pd := entry.Request.PostData
+	if pd == nil || pd.MimeType != "multipart/form-data" || len(pd.Params) != 2 || pd.Params[1].FileName != "/does/not/exist.png" {
+		t.Errorf("expected multipart params, actual %+v", pd)
+	}
+	content := entry.Response.Content
+	if content.Encoding != "base64" || content.Text != "iVBORw0KGgr/" {
+		t.Errorf("expected %s, actual %s %s", "base64 iVBORw0KGgr/", content.Encoding, content.Text)
+	}
+
+	back, err := historyFromHAR(entry)
+	if err != nil || back.ResponseBody != e.ResponseBody {
+		t.Errorf("expected %q, actual %q %v", e.ResponseBody, back.ResponseBody, err)
+	}
+}
+
+func TestHAREntrySent(t *testing.T) {
+	e := HistoryEntry{
+		Request: RequestData{Method: GET, URL: "http://{{host}}/users", Header: http.Header{"X-Token": {"{{token}}"}}},
+		URL:     "http://dev.local/users?page=2",
+		Header:  http.Header{"X-Token": {"d"}, "Accept-Encoding": {"gzip, deflate, br, zstd"}},
+		Proto:   "HTTP/2.0",
+		Status:  200,
+		Timing:  &Timing{DNS: 2 * time.Millisecond, Connect: 3 * time.Millisecond, TLS: 5 * time.Millisecond, Wait: 7 * time.Millisecond, Transfer: time.Millisecond},
+	}
+	entry, err := newHAREntry(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Request.URL != e.URL || entry.Request.QueryString[0].Value != "2" || entry.Response.HTTPVersion != "HTTP/2.0" {
+		t.Errorf("expected %s HTTP/2.0, actual %s %s", e.URL, entry.Request.URL, entry.Response.HTTPVersion)
+	}
+	expected := harTimings{Blocked: -1, DNS: 2, Connect: 8, SSL: 5, Wait: 7, Receive: 1}
+	if entry.Timings != expected {
+		t.Errorf("expected %+v, actual %+v", expected, entry.Timings)
+	}
+
+	back, err := historyFromHAR(entry)
+	if err != nil || back.Request.Header.Get("X-Token") != "d" || back.Request.Header.Get("Accept-Encoding") != "" {
+		t.Errorf("expected %v, actual %v %v", http.Header{"X-Token": {"d"}}, back.Request.Header, err)
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/manifoldco/promptui"
+)
+
+// maxHistory is the number of entries kept in memory and offered by F6
+const maxHistory = 1000
+
+// maxHistoryLine bounds an entry of the history file, longer ones are
+// skipped on load
+const maxHistoryLine = 64 * 1024 * 1024
+
+var histories []HistoryEntry
+
+// HistoryEntry is one executed request and its response
+type HistoryEntry struct {
+	Time    time.Time   `json:"time"`
+	Request RequestData `json:"request"`
+	// URL and Header are as sent, Request keeps the {{name}} placeholders
+	URL            string        `json:"url,omitempty"`
+	Header         http.Header   `json:"header,omitempty"`
+	Proto          string        `json:"proto,omitempty"`
+	Status         int           `json:"status"`
+	ResponseHeader http.Header   `json:"response_header,omitempty"`
+	ResponseBody   string        `json:"response_body,omitempty"`
+	Duration       time.Duration `json:"duration"`
+	Timing         *Timing       `json:"timing,omitempty"`
+}
+
+func (e HistoryEntry) String() string {
+	return fmt.Sprintf("%s %-7s %s %d %v", e.Time.Format("2006-01-02 15:04:05"), e.Request.Method, e.fullURL(), e.Status, e.Duration.Round(time.Millisecond))
+}
+
+func (e HistoryEntry) fullURL() string {
+	if len(e.Request.Values) == 0 {
+		return e.Request.URL
+	}
+	return e.Request.URL + "?" + e.Request.Values.Encode()
+}
+
+func (e HistoryEntry) request() (*Request, error) {
+	r, err := e.Request.request()
+	if err != nil {
+		return nil, err
+	}
+	r.ResponseStatus = e.Status
+	r.ResponseHeader = e.ResponseHeader
+	r.ResponseBody = []byte(e.ResponseBody)
+	r.ResponseTime = e.Duration
+	return r, nil
+}
+
+func loadHistory() {
+	f, err := os.Open(dataPath("history"))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Println(err)
+		}
+		return
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	var lines int
+	for {
+		line, ok, err := readLine(r, maxHistoryLine)
+		if err != nil {
+			if err != io.EOF {
+				fmt.Println("Read", dataPath("history"), err)
+			}
+			break
+		}
+		lines++
+		var e HistoryEntry
+		if !ok || json.Unmarshal(line, &e) != nil {
+			continue
+		}
+		histories = append(histories, e)
+		if len(histories) > 2*maxHistory {
+			histories = append(histories[:0], histories[len(histories)-maxHistory:]...)
+		}
+	}
+	if len(histories) > maxHistory {
+		histories = histories[len(histories)-maxHistory:]
+	}
+	// the file only grows, it is rotated to the entries kept
+	if lines > 2*maxHistory {
+		saveHistory()
+	}
+}
+
+// readLine reads a line of r without its newline, ok is false for a line
+// longer than max, which is read to its end and dropped
+func readLine(r *bufio.Reader, max int) (line []byte, ok bool, err error) {
+	ok = true
+	for {
+		chunk, isPrefix, err := r.ReadLine()
+		if err != nil {
+			return nil, false, err
+		}
+		if ok && len(line)+len(chunk) > max {
+			line, ok = nil, false
+		}
+		if ok {
+			line = append(line, chunk...)
+		}
+		if !isPrefix {
+			return line, ok, nil
+		}
+	}
+}
+
+// saveHistory rewrites the history file with the entries in memory
+func saveHistory() {
+	var buf bytes.Buffer
+	for _, e := range histories {
+		b, err := json.Marshal(e)
+		if err != nil {
+			continue
+		}
+		buf.Write(append(b, '\n'))
+	}
+	tmp := dataPath("history.tmp")
+	if err := ioutil.WriteFile(tmp, buf.Bytes(), 0600); err != nil {
+		fmt.Println(err)
+		return
+	}
+	if err := os.Rename(tmp, dataPath("history")); err != nil {
+		fmt.Println(err)
+	}
+}
+
+func addHistory(e HistoryEntry) {
+	histories = append(histories, e)
+	if len(histories) > maxHistory {
+		histories = histories[len(histories)-maxHistory:]
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	f, err := os.OpenFile(dataPath("history"), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	f.Write(append(b, '\n'))
+	f.Close()
+}
+
+// lastHistory returns the latest entry of each method sent to rawURL
+func lastHistory(rawURL string) []HistoryEntry {
+	var items []HistoryEntry
+	seen := make(map[string]bool)
+	for i := len(histories) - 1; i >= 0; i-- {
+		e := histories[i]
+		if e.Request.URL != rawURL || seen[e.Request.Method] {
+			continue
+		}
+		seen[e.Request.Method] = true
+		items = append(items, e)
+	}
+	return items
+}
+
+func history() {
+	if len(histories) == 0 {
+		fmt.Println("No History!")
+		return
+	}
+	items := make([]HistoryEntry, 0, len(histories))
+	for i := len(histories) - 1; i >= 0; i-- {
+		items = append(items, histories[i])
+	}
+
+	histSelect(items, true)
+}
+
+func histSelect(items []HistoryEntry, search bool) {
+	sel := promptui.Select{}
+	sel.Label = "History: "
+	sel.Items = items
+	sel.Size = 10
+	sel.Searcher = func(input string, index int) bool {
+		e := items[index]
+		return fuzzyMatch(e.Request.Method+" "+e.fullURL()+" "+strconv.Itoa(e.Status)+" "+e.Time.Format("2006-01-02 15:04:05"), input)
+	}
+	sel.StartInSearchMode = search
+	idx, _, err := sel.Run()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	r, err := items[idx].request()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	req = r
+	changePrefix()
+}
+
+// fuzzyMatch reports whether every space separated term of input appears in s
+// as a subsequence, ignoring case
+func fuzzyMatch(s, input string) bool {
+	s = strings.ToLower(s)
+	for _, term := range strings.Fields(strings.ToLower(input)) {
+		if strings.Contains(s, term) {
+			continue
+		}
+		t := []rune(term)
+		i := 0
+		for _, c := range s {
+			if i < len(t) && c == t[i] {
+				i++
+			}
+		}
+		if i < len(t) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestReadLine(t *testing.T) {
+	r := bufio.NewReaderSize(strings.NewReader("short\n"+strings.Repeat("x", 100)+"\nlast"), 16)
+	expected := []struct {
+		line string
+		ok   bool
+	}{{"short", true}, {"", false}, {"last", true}}
+	for _, e := range expected {
+		line, ok, err := readLine(r, 20)
+		if err != nil || string(line) != e.line || ok != e.ok {
+			t.Errorf("expected %q %v, actual %q %v %v", e.line, e.ok, line, ok, err)
+		}
+	}
+	if _, _, err := readLine(r, 20); err != io.EOF {
+		t.Errorf("expected %v, actual %v", io.EOF, err)
+	}
+}
+
+func TestLoadHistoryRotate(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	old := histories
+	defer func() { histories = old }()
+	histories = nil
+
+	var buf bytes.Buffer
+	for i := 0; i < 2*maxHistory+1; i++ {
+		fmt.Fprintf(&buf, `{"request":{"method":"GET","url":"http://a/%d"},"status":200}`+"\n", i)
+	}
+	if err := ioutil.WriteFile(dataPath("history"), buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	loadHistory()
+	if len(histories) != maxHistory || histories[maxHistory-1].Request.URL != fmt.Sprintf("http://a/%d", 2*maxHistory) {
+		t.Errorf("expected %v entries, actual %v", maxHistory, len(histories))
+	}
+	content, _ := ioutil.ReadFile(dataPath("history"))
+	if n := bytes.Count(content, []byte("\n")); n != maxHistory {
+		t.Errorf("expected %v lines, actual %v", maxHistory, n)
+	}
+	if fi, err := os.Stat(dataPath("history")); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("expected %v, actual %v %v", os.FileMode(0600), fi, err)
+	}
+}
@@ -1,9 +1,6 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
-	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -11,32 +8,74 @@ import (
 	"net/http/httputil"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 	"unicode"
 
 	prompt "github.com/c-bata/go-prompt"
 	jsoniter "github.com/json-iterator/go"
-	"github.com/manifoldco/promptui"
 	"github.com/tidwall/gjson"
 )
 
 const (
-	HELP  = "?"
-	PRINT = "p"
+	HELP    = "?"
+	PRINT   = "p"
+	ENV     = "env"
+	SET     = "set"
+	UNSET   = "unset"
+	SAVE    = "save"
+	LOAD    = "load"
+	LS      = "ls"
+	RM      = "rm"
+	MV      = "mv"
+	RUN     = "run"
+	CURL    = "curl"
+	EXPORT  = "export"
+	HAR     = "har"
+	OPENAPI = "openapi"
+	OP      = "op"
+	RUNS    = "runs"
+	COMPARE = "compare"
+	COOKIE  = "cookie"
+	OAUTH   = "oauth"
 )
 
 var (
-	json      = jsoniter.ConfigCompatibleWithStandardLibrary
-	req       = newReq()
-	scheme    = "http"
-	suggest   = newSuggestion()
-	histories = make(History)
+	json = jsoniter.ConfigCompatibleWithStandardLibrary
+	// interactive is false when running a one-shot command line
+	interactive = true
+	// verbose prints the request before its response
+	verbose = true
+	req     = newReq()
+	scheme  = "http"
+	suggest = newSuggestion()
+
+	// errOut gets the errors of parsing and sending a request, stderr in
+	// one-shot mode so they stay apart from the response
+	errOut io.Writer = os.Stdout
 )
 
-type History map[string]map[string]Request
+var commands = map[string]func(args []string){
+	ENV:     envCommand,
+	SET:     setCommand,
+	UNSET:   unsetCommand,
+	SAVE:    saveCommand,
+	LOAD:    loadCommand,
+	LS:      lsCommand,
+	RM:      rmCommand,
+	MV:      mvCommand,
+	RUN:     runCommand,
+	EXPORT:  exportCommand,
+	HAR:     harCommand,
+	OPENAPI: openapiCommand,
+	OP:      opCommand,
+	OAUTH:   oauthCommand,
+	RUNS:    runsCommand,
+	COMPARE: compareCommand,
+	COOKIE:  cookieCommand,
+}
 
 var LivePrefixState struct {
 	LivePrefix string
@@ -44,22 +83,14 @@ var LivePrefixState struct {
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(oneShot(os.Args[1:]))
+	}
 	fmt.Println("Welcome to the Httpgo!\nEnter '?' for help, Ctrl+D exit")
 	printUsage()
 	loadInitEnv()
 	prompt.New(
-		func(in string) {
-			in = strings.TrimSpace(in)
-			switch in {
-			case HELP:
-				printUsage()
-			case PRINT:
-				req.dumpRequest()
-			default:
-				parseInput(in)
-			}
-
-		},
+		executor,
 		func(in prompt.Document) []prompt.Suggest {
 			if in.GetWordBeforeCursor() == "" {
 				return []prompt.Suggest{}
@@ -77,7 +108,33 @@ func main() {
 	).Run()
 }
 
+func executor(in string) {
+	in = strings.TrimSpace(in)
+	switch in {
+	case HELP:
+		printUsage()
+	case PRINT:
+		req.dumpRequest()
+	default:
+		if curlBuf.Len() > 0 || strings.HasPrefix(in, CURL+" ") {
+			pasteCurl(in)
+			return
+		}
+		args := strings.Fields(in)
+		if len(args) > 0 {
+			if cmd, ok := commands[args[0]]; ok {
+				cmd(args[1:])
+				return
+			}
+		}
+		parseInput(in)
+	}
+}
+
 func loadInitEnv() {
+	loadEnvironments()
+	loadHistory()
+	loadCollection()
 	_, err := os.Stat("./env")
 	if err == nil || os.IsExist(err) {
 		parseInput("!env")
@@ -88,45 +145,29 @@ func loadInitEnv() {
 func parseInput(in string) {
 	var tokenizer Tokenizer
 	tokenizer.Init(in)
+	parseTokens(&tokenizer)
+}
+
+func parseTokens(tokenizer *Tokenizer) {
 	var tok Token
 	var setMethod bool
 loop:
 	for {
+		// {{name}} placeholders are kept in the request and resolved on send
 		tok = tokenizer.Next()
 		switch tok.Type {
 		case String:
 			// 脚本
 			if strings.HasPrefix(tok.Val, "!") {
-				content := readFile(tok.Val[1:])
-				if len(content) == 0 {
-					continue loop
-				}
-				fmt.Printf("> Load file `%s`\n", tok.Val[1:])
-				rd := bufio.NewReader(bytes.NewReader(content))
-				var command []string
-				for {
-					l, err := rd.ReadString('\n')
-					if err == io.EOF {
-						break
-					}
-					l = strings.TrimSpace(l)
-					if l != "" {
-						fmt.Println(">", l)
-						command = append(command, l)
-					}
-				}
-				if len(command) > 0 {
-					tokenizer.Init(strings.Join(command, " "))
-					goto loop
-				}
+				runScript(expand(tok.Val[1:]))
 				// http method
 			} else if inSlice(HTTPMethods, tok.Val) {
 				req.Method = strings.ToUpper(tok.Val)
 				setMethod = true
 				// raw json
-			} else if strings.HasPrefix(tok.Val, "{") || strings.HasPrefix(tok.Val, "[") {
+			} else if (strings.HasPrefix(tok.Val, "{") && !strings.HasPrefix(tok.Val, "{{")) || strings.HasPrefix(tok.Val, "[") {
 				var j interface{}
-				err := json.UnmarshalFromString(tok.Val, &j)
+				err := json.UnmarshalFromString(expand(tok.Val), &j)
 				if err != nil {
 					fmt.Println(err)
 					return
@@ -141,7 +182,7 @@ loop:
 				if len(req.ResponseBody) == 0 {
 					continue loop
 				}
-				jsonPath := tok.Val[1:]
+				jsonPath := expand(tok.Val[1:])
 				v := gjson.GetBytes(req.ResponseBody, jsonPath)
 				b, _ := json.MarshalIndent(v.Value(), "", " ")
 				fmt.Println("json:", jsonPath, string(b))
@@ -150,18 +191,22 @@ loop:
 			} else {
 				var _url *url.URL
 				var err error
-				if req.URL != nil && strings.HasPrefix(tok.Val, "/") {
-					_url, err = req.URL.Parse(tok.Val)
+				raw, val := tok.Val, expand(tok.Val)
+				if req.URL != nil && strings.HasPrefix(val, "/") {
+					_url, err = req.URL.Parse(val)
 					if err != nil {
-						req.errorf("parse `%s` %v\n", tok.Val, err)
+						req.errorf("parse `%s` %v\n", val, err)
 						return
 					}
-				} else if strings.HasPrefix(tok.Val, ":") || strings.HasPrefix(tok.Val, "/") {
-					_url, err = url.Parse(scheme + "://localhost" + tok.Val)
-				} else if !strings.HasPrefix(tok.Val, "http://") && !strings.HasPrefix(tok.Val, "https://") {
-					_url, err = url.Parse(scheme + "://" + tok.Val)
+					raw = urlOrigin(req.rawURL()) + raw
+				} else if strings.HasPrefix(val, ":") || strings.HasPrefix(val, "/") {
+					_url, err = url.Parse(scheme + "://localhost" + val)
+					raw = scheme + "://localhost" + raw
+				} else if !strings.HasPrefix(val, "http://") && !strings.HasPrefix(val, "https://") {
+					_url, err = url.Parse(scheme + "://" + val)
+					raw = scheme + "://" + raw
 				} else {
-					_url, err = url.Parse(tok.Val)
+					_url, err = url.Parse(val)
 					if err == nil {
 						scheme = _url.Scheme
 					}
@@ -182,6 +227,10 @@ loop:
 					req.reset()
 				}
 				req.URL = _url
+				req.RawURL = ""
+				if strings.Contains(raw, "{{") {
+					req.RawURL = raw
+				}
 			}
 		case Header:
 			req.Header.Set(tok.Key, tok.Val)
@@ -196,21 +245,40 @@ loop:
 			suggest.AddSuggest(tok.Key)
 			suggest.AddSuggest(tok.Key + "==" + tok.Val)
 		case RawJSON:
-			rawJSON(tok.Key, tok.Val)
+			// typed values are needed to parse the JSON
+			rawJSON(tok.Key, expand(tok.Val))
 			suggest.AddSuggest(tok.Key)
 			suggest.AddSuggest(tok.Key + "=:" + tok.Val)
 
 			if req.Method == GET {
 				req.Method = POST
 			}
+		case Assert:
+			if _, err := parseAssert(expand(tok.Val)); err != nil {
+				req.error(err)
+				return
+			}
+			req.addAssert(tok.Val)
+			suggest.AddSuggest("?" + tok.Val)
+		case Capture:
+			if tok.Key == "" || tok.Val == "" {
+				req.error("name<=source, eg: token<=#data.token env.sid<=cookie.SID")
+				return
+			}
+			req.Captures[tok.Key] = tok.Val
+			suggest.AddSuggest(tok.Key + "<=" + tok.Val)
 		case Variable:
-			variable(tok.Key, tok.Val)
+			value := tok.Val
+			if !rawVariables[tok.Key] {
+				value = expand(value)
+			}
+			variable(tok.Key, value)
 			suggest.AddSuggest(tok.Key)
 			suggest.AddSuggest(tok.Key + "=" + tok.Val)
 		case File:
 			if tok.Key == "" {
 				req.Body.Reset()
-				req.Body.Write(readFile(tok.Val))
+				req.Body.WriteString(string(readFile(tok.Val)))
 				suggest.AddSuggest("@" + tok.Val)
 			} else {
 				req.Files.Add(tok.Key, tok.Val)
@@ -230,66 +298,88 @@ loop:
 		changePrefix()
 		return
 	}
-	if m, ok := histories[req.URL.String()]; ok {
-		l := len(m)
-		if !setMethod && l > 1 {
-			items := make([]Request, l, l)
-			i := 0
-			for _, r := range m {
-				items[i] = r
-			}
-			histSelect(items)
-		} else if !setMethod && l == 1 {
-			for _, r := range m {
-				*req = r
-			}
+	if items := lastHistory(req.rawURL()); !interactive || setMethod {
+	} else if len(items) > 1 {
+		histSelect(items, false)
+	} else if len(items) == 1 {
+		if r, err := items[0].request(); err == nil {
+			req = r
 		}
 	}
 	changePrefix()
 }
 
-func history() {
-	if len(histories) == 0 {
-		fmt.Println("No History!")
-		return
-	}
-	items := []Request{}
+// rawVariables may hold secrets, they keep their {{placeholders}} until
+// the request is sent
+var rawVariables = map[string]bool{"$auth": true, "$proxy": true, "$p12pass": true}
 
-	for _, h := range histories {
-		for _, r := range h {
-			items = append(items, r)
-		}
+// urlOrigin is the scheme and host of rawURL
+func urlOrigin(rawURL string) string {
+	i := strings.Index(rawURL, "://")
+	if i < 0 {
+		return rawURL
 	}
-
-	histSelect(items)
-}
-
-func histSelect(items []Request) {
-	sel := promptui.Select{}
-	sel.Label = "History: "
-	sel.Items = items
-	idx, _, err := sel.Run()
-	if err != nil {
-		fmt.Println(err)
-		return
+	if j := strings.IndexAny(rawURL[i+3:], "/?#"); j >= 0 {
+		return rawURL[:i+3+j]
 	}
-	req = &(items[idx])
+	return rawURL
 }
 
 func changePrefix() {
 	LivePrefixState.IsEnable = true
+	var prefix string
+	if activeEnv != "" {
+		prefix = "[" + activeEnv + "] "
+	}
 	if req.URL != nil {
-		LivePrefixState.LivePrefix = req.Method + " " + req.URL.String() + " > "
+		prefix += req.Method + " " + req.URL.String() + " "
 	} else if req.Method != "" {
-		LivePrefixState.LivePrefix = req.Method + " > "
+		prefix += req.Method + " "
 	}
+	LivePrefixState.LivePrefix = prefix + "> "
 }
 
 func printUsage() {
 	fmt.Println(`
   p print current request info
-  Ctrl + c reset current state
+  Ctrl + c reset current state, cancel a running bench
   Ctrl + r do request
+  F6 search request history
+  env [name|-] list or switch environments
+  set key=value set variable in active environment, use as {{key}}
+  unset key remove variable from active environment
+  save name save current request to collection, folders like users/create
+  load name load request from collection
+  ls [folder] list saved requests
+  rm name|folder remove saved requests
+  mv old new rename saved request or folder
+  run [folder] send saved requests in order
+  curl ... import a curl command, pasted multi-line commands are supported
+  export curl|httpie|go|python [file] export current request as code
+  har export|import file export history to or import entries from a HAR file
+  $bench=10,1000 $bench=10,30s $rate=500/s,30s run a benchmark with Ctrl + r
+  $stages=30s:50,2m:50,30s:0 ramp workers through {duration}:{workers} stages
+  $cert=client.pem $key=client.key $p12=client.p12 $p12pass=secret client certificate
+  $cacert=ca.pem $insecure $servername=host $tlsmin=1.2 $tlsmax=1.3 $ciphers=a,b TLS settings
+  set $cert=client.pem save TLS settings in the active environment
+  $redirects=follow|none|N redirect policy, $keepauth keeps Authorization across hosts
+  $keepmethod keeps method and body on 301, 302 and 303 redirects, 307 and 308 always do
+  $trace print DNS, connect, TLS, wait and transfer times of the request
+  $tlsinfo print the TLS handshake and certificate chain, $pin=sha256/<base64> pins the public key
+  $auth=user:pass basic auth, $auth=digest:user:pass digest auth (MD5, SHA-256, -sess, qop=auth|auth-int)
+  $auth=digest with $bench workers share the nonce count, a server requiring it in order may refuse some requests
+  oauth [set name key=value...|rm name|token name|logout name] OAuth 2.0 profiles of the active environment
+  $oauth=name send a bearer token of the profile, refreshed when expired or on 401
+  cookie [ls [host]|send|set name=value [host]|rm name [host]|clear [host]|persist on|off] manage the cookie jar
+  $proto=http1|h2|h2c|auto force HTTP/1.1, HTTP/2 over TLS or cleartext h2c
+  $run=name save the next bench run as name, runs list saved runs
+  compare base [run] compare two bench runs, run defaults to the latest
+  {{$seq}} {{$randInt:1:100}} {{$randString:8}} {{$uuid}} {{$timestamp}} {{$csv:file:column}} new value per request
+  name<=#data.token capture #path, header.X, cookie.X or ~regexp into {{name}}, env.name<= saves it
+  !file run a script of request blocks separated by ---
+  ?status==200 ?#data.id==3 ?header.X-Id ?body*=ok ?time<500 assert the response
+  openapi file|url load an OpenAPI 3 or Swagger 2 document for completion
+  op [operationId|METHOD path] scaffold current request from an operation
 	`)
 }
 
@@ -310,107 +400,197 @@ func bindSave() prompt.KeyBind {
 
 func bindReset() prompt.KeyBind {
 	return prompt.KeyBind{Key: prompt.ControlC, Fn: func(buf *prompt.Buffer) {
-		LivePrefixState.IsEnable = false
+		if cancelBench() {
+			return
+		}
 		r := newReq()
 		r.Proxy = req.Proxy
 		req = r
+		changePrefix()
 	}}
 }
 
 func bindDoRequest() prompt.KeyBind {
 	return prompt.KeyBind{Key: prompt.ControlR, Fn: func(buf *prompt.Buffer) {
+		// bench in the background so Ctrl+C can cancel it
 		if req.Bench {
-			client := http.Client{Timeout: req.Timeout}
-			r, err := req.newHTTPRequest()
+			b, err := benchRequest()
 			if err != nil {
 				fmt.Println(err)
 				return
 			}
-			c := make(chan struct{}, req.Concurrency)
-			var wg sync.WaitGroup
-
-			var do = func() {
-				defer func() {
-					<-c
-					wg.Done()
-				}()
-				client.Do(r)
-			}
-
-			if int64(req.Duration) != 0 {
-				ctx, cancel := context.WithTimeout(context.Background(), req.Duration)
-				defer cancel()
-			bench:
-				for {
-					select {
-					case <-ctx.Done():
-						break bench
-					default:
-						c <- struct{}{}
-						wg.Add(1)
-						go do()
-					}
-				}
-			} else {
-				if req.NumberOfRequest == 0 {
-					req.NumberOfRequest = 1
-				}
-				for ; req.NumberOfRequest > 0; req.NumberOfRequest-- {
-					c <- struct{}{}
-					wg.Add(1)
-					go do()
-				}
-			}
-			wg.Wait()
-
-		} else {
-			httpCall()
+			go bench(b)
+			return
 		}
+		doRequest()
 	}}
 }
 
-func httpCall() {
-	if int64(req.Timeout) == 0 {
-		req.Timeout = time.Second * 30
+func doRequest() error {
+	if req.Bench {
+		b, err := benchRequest()
+		if err != nil {
+			fmt.Fprintln(errOut, err)
+			return err
+		}
+		return bench(b)
+	}
+	return httpCall()
+}
+
+// newClient returns the http client configured by r
+func newClient(r *Request) (*http.Client, error) {
+	if int64(r.Timeout) == 0 {
+		r.Timeout = time.Second * 30
 	}
-	client := http.Client{Timeout: req.Timeout}
-	if req.Proxy != "" {
-		proxyURL, err := url.Parse(req.Proxy)
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if r.Proxy != "" {
+		proxyURL, err := url.Parse(expand(r.Proxy))
 		if err != nil {
-			fmt.Println(err)
-			return
+			return nil, err
 		}
-		transport := &http.Transport{Proxy: http.ProxyURL(proxyURL)}
-		client.Transport = transport
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	opts := r.TLS
+	if e, ok := environments[activeEnv]; ok {
+		opts = opts.merge(e.TLS)
 	}
+	tlsConfig, err := opts.config()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+	// http1 never upgrades, h2 requires HTTP/2 over TLS and h2c talks
+	// HTTP/2 with prior knowledge to cleartext servers
+	var protocols http.Protocols
+	switch r.Proto {
+	case "http1":
+		protocols.SetHTTP1(true)
+	case "h2":
+		protocols.SetHTTP2(true)
+	case "h2c":
+		protocols.SetUnencryptedHTTP2(true)
+	}
+	if r.Proto != "" {
+		transport.Protocols = &protocols
+	}
+	if r.Bench {
+		// MaxIdleConns of the default transport is 100 for all hosts
+		transport.MaxIdleConns = r.maxConns()
+		transport.MaxIdleConnsPerHost = r.maxConns()
+	}
+	return &http.Client{Timeout: r.Timeout, Transport: transport, Jar: currentJar(), CheckRedirect: checkRedirect(r)}, nil
+}
 
-	r, err := req.newHTTPRequest()
+func httpCall() error {
+	client, err := newClient(req)
 	if err != nil {
-		fmt.Println(err)
-		return
+		fmt.Fprintln(errOut, err)
+		return err
 	}
-	out, _ := httputil.DumpRequest(r, true)
-	fmt.Printf("\n%s\n", colorize(out))
-	resp, err := client.Do(r)
+
+	data := req.data()
+	r, err := buildRequest(data, gen.next(), interactive)
 	if err != nil {
-		fmt.Println(err)
-		return
+		fmt.Fprintln(errOut, err)
+		return err
+	}
+	if verbose {
+		out, _ := httputil.DumpRequest(r, true)
+		fmt.Printf("\n%s\n", colorize(out))
+	}
+	t, ctx := newTracer(r.Context())
+	start := time.Now()
+	resp, err := client.Do(r.WithContext(ctx))
+	if err == nil && resp.StatusCode == http.StatusUnauthorized && req.OAuth != "" &&
+		invalidateOAuth(req.OAuth, r.Header.Get("Authorization")) {
+		// the token was revoked or expired early, retry once with a new one
+		resp.Body.Close()
+		fmt.Println("> 401 Unauthorized, refresh token of", req.OAuth, "and retry")
+		if r, err = buildRequest(data, gen.next(), interactive); err != nil {
+			fmt.Fprintln(errOut, err)
+			return err
+		}
+		t, ctx = newTracer(r.Context())
+		start = time.Now()
+		resp, err = client.Do(r.WithContext(ctx))
+	}
+	if err == nil && resp.StatusCode == http.StatusUnauthorized && req.AuthType == "digest" &&
+		digestChallenged(r, resp) {
+		// answer the digest challenge, the nonce is kept for the next requests
+		resp.Body.Close()
+		if r, err = buildRequest(data, gen.next(), interactive); err != nil {
+			fmt.Fprintln(errOut, err)
+			return err
+		}
+		if verbose {
+			fmt.Printf("> 401 Unauthorized, retry with %s\n", r.Header.Get("Authorization"))
+		}
+		t, ctx = newTracer(r.Context())
+		start = time.Now()
+		resp, err = client.Do(r.WithContext(ctx))
+	}
+	if err != nil {
+		if req.TLSInfo {
+			// the chain that failed to verify, with its warnings
+			if cs := unverifiedTLS(client, r.URL, err); cs != nil {
+				fmt.Println("")
+				printTLS(cs, r.URL.Hostname())
+			}
+		}
+		fmt.Fprintln(errOut, err)
+		return err
 	}
 	defer resp.Body.Close()
-	out, _ = httputil.DumpResponse(resp, true)
+	out, _ := httputil.DumpResponse(resp, true)
+	req.ResponseTime = time.Since(start)
+	t.finish()
+	if req.TLSInfo {
+		if resp.TLS != nil {
+			fmt.Println("")
+			printTLS(resp.TLS, r.URL.Hostname())
+		} else {
+			fmt.Println("> Not a TLS connection")
+		}
+	}
 	fmt.Printf("\n%s\n", colorize(out))
+	if req.Trace {
+		t.waterfall()
+	}
+	req.ResponseStatus = resp.StatusCode
+	req.ResponseHeader = resp.Header
 	req.ResponseBody, _ = ioutil.ReadAll(resp.Body)
 
-	histories[req.URL.String()] = make(map[string]Request)
-	histories[req.URL.String()][req.Method] = *req
+	addHistory(HistoryEntry{
+		Time:           start,
+		Request:        data,
+		URL:            r.URL.String(),
+		Header:         r.Header.Clone(),
+		Proto:          resp.Proto,
+		Status:         resp.StatusCode,
+		ResponseHeader: resp.Header,
+		ResponseBody:   string(req.ResponseBody),
+		Duration:       req.ResponseTime,
+		Timing:         t.timing(),
+	})
+	currentJar().save()
+	if len(req.Asserts) > 0 {
+		checkAsserts(req)
+	}
+	if len(req.Captures) > 0 {
+		applyCaptures(req)
+	}
+	return nil
 }
 
 func rawJSON(key, value string) {
 	var j interface{}
 	var err error
 	if strings.HasPrefix(value, "@") {
-		content := readFile(value[1:])
-		err = json.Unmarshal(content, &j)
+		content := expand(string(readFile(value[1:])))
+		err = json.UnmarshalFromString(content, &j)
 		if err != nil {
 			req.error("Read from file", value[1:], "unmarshal", err)
 			return
@@ -441,14 +621,26 @@ func readFile(filename string) []byte {
 	return content
 }
 
+// dataPath returns the path of name in the httpgo data directory ~/.httpgo
+func dataPath(name string) string {
+	dir, err := os.UserHomeDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	dir = filepath.Join(dir, ".httpgo")
+	os.MkdirAll(dir, 0700)
+	return filepath.Join(dir, name)
+}
+
 func variable(key, value string) {
 	switch key {
 	case "$auth":
-		pair := strings.Split(value, ":")
-		if len(pair) > 1 {
-			req.Username = pair[0]
-			req.Password = strings.Join(pair[1:], "")
+		authType, username, password, err := parseAuth(value)
+		if err != nil {
+			fmt.Println(err)
+			return
 		}
+		req.AuthType, req.Username, req.Password = authType, username, password
 	case "$json":
 		req.JSON = true
 		req.Form = false
@@ -469,12 +661,14 @@ func variable(key, value string) {
 	case "$bench":
 		pair := strings.Split(value, ",")
 		if len(pair) != 2 {
-			req.errorf("$bench={concurrency},{total_request or duration}, eg: $bench=10,10s $bench=10,1000")
+			req.errorf("$bench={concurrency},{total_request or duration}, eg: $bench=10,10s $bench=10,1000\n")
 			return
 		}
 		c, err := strconv.ParseUint(pair[0], 10, 64)
 		if err == nil {
 			req.Bench = true
+			req.Rate = 0
+			req.Stages = nil
 			req.Concurrency = c
 		} else {
 			req.errorf("$bench=%s %v\n", value, err)
@@ -485,20 +679,107 @@ func variable(key, value string) {
 			if err == nil {
 				req.Bench = true
 				req.Duration = d
+				req.NumberOfRequest = 0
 			} else {
 				req.errorf("$bench=%s %v\n", value, err)
 			}
 		} else if pair[1] != "" {
-			n, err := strconv.ParseUint(pair[0], 10, 64)
+			n, err := strconv.ParseUint(pair[1], 10, 64)
 			if err == nil {
 				req.Bench = true
 				req.NumberOfRequest = n
+				req.Duration = 0
 			} else {
 				req.errorf("$bench=%s %v\n", value, err)
 			}
 		}
+	case "$rate":
+		pair := strings.Split(value, ",")
+		rate := strings.SplitN(pair[0], "/", 2)
+		n, err := strconv.ParseFloat(rate[0], 64)
+		if err != nil || n <= 0 || len(pair) > 2 {
+			req.errorf("$rate={requests}/{s|m|h}[,{duration}], eg: $rate=500/s,30s\n")
+			return
+		}
+		if len(rate) == 2 {
+			switch rate[1] {
+			case "s", "":
+			case "m":
+				n /= 60
+			case "h":
+				n /= 3600
+			default:
+				req.errorf("$rate=%s unknown unit `%s`\n", value, rate[1])
+				return
+			}
+		}
+		if len(pair) == 2 {
+			d, err := time.ParseDuration(pair[1])
+			if err != nil {
+				req.errorf("$rate=%s %v\n", value, err)
+				return
+			}
+			req.Duration = d
+		}
+		if req.Duration == 0 {
+			req.errorf("$rate=%s needs a duration, eg: $rate=500/s,30s\n", value)
+			return
+		}
+		req.Bench = true
+		req.Rate = n
+		req.Stages = nil
+	case "$stages":
+		stages, err := parseStages(value)
+		if err != nil {
+			req.errorf("$stages=%s %v, eg: $stages=30s:50,2m:50,1m:200,30s:0\n", value, err)
+			return
+		}
+		req.Bench = true
+		req.Rate = 0
+		req.Stages = stages
+	case "$proto":
+		switch value {
+		case "http1", "h2", "h2c":
+			req.Proto = value
+		case "auto", "":
+			req.Proto = ""
+		default:
+			req.errorf("$proto=http1|h2|h2c|auto, eg: $proto=h2c\n")
+		}
+	case "$oauth":
+		if value == "-" {
+			value = ""
+		}
+		req.OAuth = value
+	case "$redirects":
+		n, err := parseRedirects(value)
+		if err != nil {
+			req.error(err)
+			return
+		}
+		req.Redirects = n
+	case "$keepauth":
+		req.KeepAuth = value != "false"
+	case "$keepmethod":
+		req.KeepMethod = value != "false"
+	case "$trace":
+		req.Trace = value != "false"
+	case "$tlsinfo":
+		req.TLSInfo = value != "false"
+	case "$run":
+		if value == "" || strings.ContainsAny(value, `/\`) {
+			req.errorf("$run={name}, eg: $run=before-deploy\n")
+			return
+		}
+		req.RunName = value
 
 	default:
+		if isTLSVariable(key) {
+			if err := req.TLS.set(key, value); err != nil {
+				req.error(err)
+			}
+			return
+		}
 		req.error("unknown", key)
 	}
 }
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// loginTimeout bounds a token fetch, including the wait for the browser in
+// the authorization code flow
+const loginTimeout = 5 * time.Minute
+
+var (
+	// oauthMu guards oauthTokens and oauthFlights, it is not held while a
+	// token is fetched
+	oauthMu sync.Mutex
+	// oauthTokens are the cached tokens of each environment by profile,
+	// saved apart from the environments in dataPath("oauth")
+	oauthTokens  = make(map[string]map[string]*oauth2.Token)
+	oauthFlights = make(map[string]*oauthFlight)
+)
+
+// oauthFlight is a token fetch in progress, other requests of the same
+// profile wait for it
+type oauthFlight struct {
+	done chan struct{}
+	tok  *oauth2.Token
+	err  error
+}
+
+// OAuthProfile is an OAuth 2.0 client of an environment, its values may
+// reference {{variables}}. Flow is one of client_credentials, password,
+// authorization_code or refresh_token.
+type OAuthProfile struct {
+	Flow         string `json:"flow"`
+	TokenURL     string `json:"token_url"`
+	AuthURL      string `json:"auth_url,omitempty"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	Audience     string `json:"audience,omitempty"`
+	Username     string `json:"username,omitempty"`
+	Password     string `json:"password,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	RedirectPort int    `json:"redirect_port,omitempty"`
+}
+
+func (p *OAuthProfile) set(key, value string) error {
+	switch key {
+	case "flow":
+		switch value {
+		case "client_credentials", "password", "authorization_code", "refresh_token":
+		default:
+			return fmt.Errorf("flow=client_credentials|password|authorization_code|refresh_token")
+		}
+		p.Flow = value
+	case "token_url":
+		p.TokenURL = value
+	case "auth_url":
+		p.AuthURL = value
+	case "client_id":
+		p.ClientID = value
+	case "client_secret":
+		p.ClientSecret = value
+	case "scope":
+		p.Scope = value
+	case "audience":
+		p.Audience = value
+	case "username":
+		p.Username = value
+	case "password":
+		p.Password = value
+	case "refresh_token":
+		p.RefreshToken = value
+	case "redirect_port":
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("redirect_port=%s %v", value, err)
+		}
+		p.RedirectPort = n
+	default:
+		return fmt.Errorf("unknown key `%s`", key)
+	}
+	return nil
+}
+
+func (p *OAuthProfile) config() *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     expand(p.ClientID),
+		ClientSecret: expand(p.ClientSecret),
+		Scopes:       strings.FieldsFunc(expand(p.Scope), func(r rune) bool { return r == ' ' || r == ',' }),
+		Endpoint:     oauth2.Endpoint{AuthURL: expand(p.AuthURL), TokenURL: expand(p.TokenURL)},
+	}
+}
+
+// fetch runs the flow of p, login allows the browser of the authorization
+// code flow
+func (p *OAuthProfile) fetch(ctx context.Context, login bool) (*oauth2.Token, error) {
+	conf := p.config()
+	var opts []oauth2.AuthCodeOption
+	if p.Audience != "" {
+		opts = append(opts, oauth2.SetAuthURLParam("audience", expand(p.Audience)))
+	}
+	switch p.Flow {
+	case "client_credentials":
+		cc := clientcredentials.Config{ClientID: conf.ClientID, ClientSecret: conf.ClientSecret, TokenURL: conf.Endpoint.TokenURL, Scopes: conf.Scopes}
+		if p.Audience != "" {
+			cc.EndpointParams = map[string][]string{"audience": {expand(p.Audience)}}
+		}
+		return cc.Token(ctx)
+	case "password":
+		return conf.PasswordCredentialsToken(ctx, expand(p.Username), expand(p.Password))
+	case "refresh_token":
+		return conf.TokenSource(ctx, &oauth2.Token{RefreshToken: expand(p.RefreshToken)}).Token()
+	case "authorization_code":
+		if !login {
+			return nil, fmt.Errorf("authorization_code needs a browser login, run `oauth token <name>` at the prompt first")
+		}
+		return p.login(ctx, conf, opts)
+	}
+	return nil, fmt.Errorf("unknown flow `%s`", p.Flow)
+}
+
+// login opens the browser on the authorization endpoint and waits for the
+// code on a loopback redirect listener, with PKCE
+func (p *OAuthProfile) login(ctx context.Context, conf *oauth2.Config, opts []oauth2.AuthCodeOption) (*oauth2.Token, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:"+strconv.Itoa(p.RedirectPort))
+	if err != nil {
+		return nil, err
+	}
+	defer l.Close()
+	conf.RedirectURL = fmt.Sprintf("http://%s/callback", l.Addr())
+
+	b := make([]byte, 16)
+	rand.Read(b)
+	state := hex.EncodeToString(b)
+	verifier := oauth2.GenerateVerifier()
+
+	type result struct {
+		code string
+		err  error
+	}
+	c := make(chan result, 1)
+	// the first callback wins, a browser retry finds the channel full
+	var send = func(res result) {
+		select {
+		case c <- res:
+		default:
+		}
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch {
+		case r.URL.Path != "/callback":
+			http.NotFound(w, r)
+			return
+		case q.Get("error") != "":
+			send(result{err: fmt.Errorf("%s %s", q.Get("error"), q.Get("error_description"))})
+		case q.Get("state") != state:
+			send(result{err: fmt.Errorf("state mismatch")})
+		default:
+			send(result{code: q.Get("code")})
+		}
+		fmt.Fprintln(w, "httpgo: login finished, you can close this window.")
+	})}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	authURL := conf.AuthCodeURL(state, append(opts, oauth2.S256ChallengeOption(verifier))...)
+	fmt.Println("> Open in your browser to log in:")
+	fmt.Println(authURL)
+	openBrowser(authURL)
+
+	select {
+	case res := <-c:
+		if res.err != nil {
+			return nil, res.err
+		}
+		return conf.Exchange(ctx, res.code, append(opts, oauth2.VerifierOption(verifier))...)
+	case <-ctx.Done():
+		return nil, fmt.Errorf("login %v", ctx.Err())
+	}
+}
+
+func openBrowser(u string) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", u)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", u)
+	default:
+		cmd = exec.Command("xdg-open", u)
+	}
+	// reaped in the background, the browser may outlive the login
+	if cmd.Start() == nil {
+		go cmd.Wait()
+	}
+}
+
+func oauthProfile(name string) (*OAuthProfile, error) {
+	e, ok := environments[activeEnv]
+	if !ok {
+		return nil, fmt.Errorf("no active environment for oauth profile `%s`", name)
+	}
+	p, ok := e.OAuth[name]
+	if !ok {
+		return nil, fmt.Errorf("oauth profile `%s` not found in `%s`", name, activeEnv)
+	}
+	return p, nil
+}
+
+// tokenFile is the token cache of env, the tokens of an environment whose
+// name is not a file name stay in memory
+func tokenFile(env string) (string, error) {
+	if !validEnvName(env) {
+		return "", fmt.Errorf("environment `%s` is not a file name, tokens are not saved", env)
+	}
+	dir := dataPath("oauth")
+	os.MkdirAll(dir, 0700)
+	return filepath.Join(dir, env+".json"), nil
+}
+
+// tokens returns the cached tokens of env, oauthMu must be held
+func tokens(env string) map[string]*oauth2.Token {
+	t, ok := oauthTokens[env]
+	if !ok {
+		t = make(map[string]*oauth2.Token)
+		oauthTokens[env] = t
+		filename, err := tokenFile(env)
+		if err != nil {
+			return t
+		}
+		if content, err := ioutil.ReadFile(filename); err == nil {
+			if err = json.Unmarshal(content, &t); err != nil {
+				fmt.Println("Unmarshal", filename, err)
+			}
+		} else if !os.IsNotExist(err) {
+			fmt.Println("Read file", filename, err)
+		}
+	}
+	return t
+}
+
+// saveTokens writes the tokens of env readable by the owner only, oauthMu
+// must be held
+func saveTokens(env string) {
+	b, err := json.Marshal(tokens(env))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	filename, err := tokenFile(env)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if err = ioutil.WriteFile(filename, b, 0600); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// dropToken forgets the cached token of profile name
+func dropToken(name string) {
+	oauthMu.Lock()
+	defer oauthMu.Unlock()
+	if _, ok := tokens(activeEnv)[name]; ok {
+		delete(tokens(activeEnv), name)
+		saveTokens(activeEnv)
+	}
+}
+
+// oauthToken returns the cached token of profile name, it is refreshed
+// with the refresh token or fetched again when expired or force is set.
+// Concurrent calls for a profile share one fetch. r configures the client
+// of the token endpoint, login allows the browser of the authorization code
+// flow.
+func oauthToken(r *Request, name string, force, login bool) (*oauth2.Token, error) {
+	oauthMu.Lock()
+	env := activeEnv
+	p, err := oauthProfile(name)
+	if err != nil {
+		oauthMu.Unlock()
+		return nil, err
+	}
+	cached := tokens(env)[name]
+	if cached != nil && cached.Valid() && !force {
+		oauthMu.Unlock()
+		return cached, nil
+	}
+	key := env + "/" + name
+	if f, ok := oauthFlights[key]; ok {
+		oauthMu.Unlock()
+		<-f.done
+		return f.tok, f.err
+	}
+	f := &oauthFlight{done: make(chan struct{})}
+	oauthFlights[key] = f
+	profile := *p
+	oauthMu.Unlock()
+
+	f.tok, f.err = profile.token(r, name, cached, login)
+
+	oauthMu.Lock()
+	if f.err == nil {
+		tokens(env)[name] = f.tok
+		saveTokens(env)
+	}
+	delete(oauthFlights, key)
+	oauthMu.Unlock()
+	close(f.done)
+	return f.tok, f.err
+}
+
+// token refreshes cached or runs the flow of p
+func (p *OAuthProfile) token(r *Request, name string, cached *oauth2.Token, login bool) (*oauth2.Token, error) {
+	client, err := newClient(&Request{Proxy: r.Proxy, TLS: r.TLS, Proto: r.Proto, Timeout: r.Timeout})
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), oauth2.HTTPClient, client), loginTimeout)
+	defer cancel()
+	if cached != nil && cached.RefreshToken != "" {
+		expired := *cached
+		expired.Expiry = time.Unix(1, 0)
+		tok, err := p.config().TokenSource(ctx, &expired).Token()
+		if err == nil {
+			return tok, nil
+		}
+		fmt.Println("> Refresh token of", name, err)
+	}
+	tok, err := p.fetch(ctx, login)
+	if err != nil {
+		return nil, fmt.Errorf("oauth `%s` %v", name, err)
+	}
+	return tok, nil
+}
+
+// oauth                              list profiles of the active environment
+// oauth set <name> key=value...      create or update a profile
+// oauth rm <name>                    remove a profile
+// oauth token <name>                 fetch a new token
+// oauth logout <name>                forget the cached token
+func oauthCommand(args []string) {
+	e, ok := environments[activeEnv]
+	if !ok {
+		fmt.Println("No active environment, use `env <name>` first")
+		return
+	}
+	if len(args) == 0 {
+		names := make([]string, 0, len(e.OAuth))
+		for name := range e.OAuth {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		oauthMu.Lock()
+		cached := tokens(activeEnv)
+		oauthMu.Unlock()
+		for _, name := range names {
+			p := e.OAuth[name]
+			status := "no token"
+			if tok := cached[name]; tok != nil {
+				if tok.Valid() {
+					status = "token expires " + tok.Expiry.Format("2006-01-02 15:04:05")
+					if tok.Expiry.IsZero() {
+						status = "token without expiry"
+					}
+				} else {
+					status = "token expired"
+				}
+			}
+			fmt.Printf("  %-16s %-20s %s (%s)\n", name, p.Flow, p.TokenURL, status)
+		}
+		return
+	}
+	if len(args) < 2 {
+		fmt.Println("oauth [set <name> key=value...|rm <name>|token <name>|logout <name>]")
+		return
+	}
+	name := args[1]
+	switch args[0] {
+	case "set":
+		if e.OAuth == nil {
+			e.OAuth = make(map[string]*OAuthProfile)
+		}
+		p, ok := e.OAuth[name]
+		if !ok {
+			p = &OAuthProfile{Flow: "client_credentials"}
+		}
+		for _, arg := range args[2:] {
+			pair := strings.SplitN(arg, "=", 2)
+			if len(pair) != 2 {
+				fmt.Println("oauth set <name> key=value, eg: oauth set api flow=client_credentials token_url=https://auth/token client_id=x client_secret={{secret}}")
+				return
+			}
+			if err := p.set(pair[0], pair[1]); err != nil {
+				fmt.Println(err)
+				return
+			}
+		}
+		e.OAuth[name] = p
+		dropToken(name)
+		suggest.AddSuggest(name)
+	case "rm":
+		delete(e.OAuth, name)
+		dropToken(name)
+	case "token":
+		tok, err := oauthToken(req, name, true, interactive)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Printf("> %s %s, expires %v\n", tok.Type(), maskToken(tok.AccessToken), tok.Expiry.Format("2006-01-02 15:04:05"))
+		return
+	case "logout":
+		dropToken(name)
+		return
+	default:
+		fmt.Println("oauth [set <name> key=value...|rm <name>|token <name>|logout <name>]")
+		return
+	}
+	saveEnvironments()
+}
+
+// maskToken keeps the start of tok to tell tokens apart
+func maskToken(tok string) string {
+	if len(tok) <= 12 {
+		return "******"
+	}
+	return tok[:6] + "******"
+}
+
+// invalidateOAuth expires the cached token of profile name after a 401 if
+// auth, the Authorization header sent, still holds it
+func invalidateOAuth(name, auth string) bool {
+	oauthMu.Lock()
+	defer oauthMu.Unlock()
+	tok := tokens(activeEnv)[name]
+	if tok == nil || auth != tok.Type()+" "+tok.AccessToken {
+		return false
+	}
+	expired := *tok
+	expired.Expiry = time.Unix(1, 0)
+	tokens(activeEnv)[name] = &expired
+	return true
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestOAuthProfileSet(t *testing.T) {
+	p := &OAuthProfile{Flow: "client_credentials"}
+	if err := p.set("flow", "password"); err != nil || p.Flow != "password" {
+		t.Errorf("expected %v, actual %v %v", "password", p.Flow, err)
+	}
+	if err := p.set("flow", "implicit"); err == nil {
+		t.Errorf("expected error, actual nil")
+	}
+	if err := p.set("redirect_port", "8085"); err != nil || p.RedirectPort != 8085 {
+		t.Errorf("expected %v, actual %v %v", 8085, p.RedirectPort, err)
+	}
+	if err := p.set("nope", "x"); err == nil {
+		t.Errorf("expected error, actual nil")
+	}
+}
+
+func TestOAuthProfileScopes(t *testing.T) {
+	p := &OAuthProfile{Scope: "read write,admin"}
+	actual := p.config().Scopes
+	if len(actual) != 3 || actual[0] != "read" || actual[2] != "admin" {
+		t.Errorf("expected %v, actual %v", []string{"read", "write", "admin"}, actual)
+	}
+}
+
+// testOAuth sets up a token endpoint and an environment with profile api,
+// grants records the grant_type of each token request
+func testOAuth(t *testing.T, flow string) (grants func() []string) {
+	var (
+		mu   sync.Mutex
+		seen []string
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		mu.Lock()
+		seen = append(seen, r.Form.Get("grant_type"))
+		n := len(seen)
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"tok%d","token_type":"Bearer","refresh_token":"r%d","expires_in":3600}`, n, n)
+	}))
+	t.Cleanup(ts.Close)
+	t.Setenv("HOME", t.TempDir())
+
+	oldEnvs, oldActive := environments, activeEnv
+	environments = map[string]*Environment{"test": {Vars: map[string]string{}, OAuth: map[string]*OAuthProfile{
+		"api": {Flow: flow, TokenURL: ts.URL + "/token", ClientID: "c", ClientSecret: "s", Username: "u", Password: "p"},
+	}}}
+	activeEnv = "test"
+	oauthTokens = make(map[string]map[string]*oauth2.Token)
+	t.Cleanup(func() { environments, activeEnv = oldEnvs, oldActive })
+
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), seen...)
+	}
+}
+
+func TestOAuthToken(t *testing.T) {
+	grants := testOAuth(t, "client_credentials")
+	r := newReq()
+
+	tok, err := oauthToken(r, "api", false, false)
+	if err != nil || tok.AccessToken != "tok1" {
+		t.Fatalf("expected %v, actual %v %v", "tok1", tok, err)
+	}
+	// cached
+	if tok, _ = oauthToken(r, "api", false, false); tok.AccessToken != "tok1" || len(grants()) != 1 {
+		t.Errorf("expected %v, actual %v %v", "tok1", tok.AccessToken, grants())
+	}
+
+	// expired, refreshed with the refresh token
+	oauthMu.Lock()
+	tokens("test")["api"].Expiry = time.Now().Add(-time.Minute)
+	oauthMu.Unlock()
+	if tok, _ = oauthToken(r, "api", false, false); tok.AccessToken != "tok2" || grants()[1] != "refresh_token" {
+		t.Errorf("expected %v, actual %v %v", "tok2 refresh_token", tok.AccessToken, grants())
+	}
+
+	// a 401 for another token leaves the cache alone
+	if invalidateOAuth("api", "Bearer tok1") {
+		t.Errorf("expected %v, actual %v", false, true)
+	}
+	if !invalidateOAuth("api", "Bearer tok2") {
+		t.Errorf("expected %v, actual %v", true, false)
+	}
+
+	// refetched once for concurrent requests after the 401
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if tok, err := oauthToken(r, "api", false, false); err != nil || tok.AccessToken != "tok3" {
+				t.Errorf("expected %v, actual %v %v", "tok3", tok, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if len(grants()) != 3 {
+		t.Errorf("expected %v, actual %v", 3, grants())
+	}
+	if tokens("test")["api"].AccessToken != "tok3" {
+		t.Errorf("expected %v, actual %v", "tok3", tokens("test")["api"])
+	}
+
+	// saved apart from the environments, readable by the owner only
+	filename, _ := tokenFile("test")
+	if fi, err := os.Stat(filename); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("expected %v, actual %v %v", os.FileMode(0600), fi, err)
+	}
+	oauthTokens = make(map[string]map[string]*oauth2.Token)
+	if tok, _ = oauthToken(r, "api", false, false); tok.AccessToken != "tok3" || len(grants()) != 3 {
+		t.Errorf("expected %v, actual %v %v", "tok3", tok.AccessToken, grants())
+	}
+}
+
+func TestTokenFile(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	for _, env := range []string{"../../x", `a\b`, ".."} {
+		if _, err := tokenFile(env); err == nil {
+			t.Errorf("%s expected error, actual nil", env)
+		}
+	}
+	if _, err := tokenFile("dev"); err != nil {
+		t.Errorf("expected nil, actual %v", err)
+	}
+	if maskToken("eyJhbGciOiJIUzI1NiJ9.secret") != "eyJhbG******" {
+		t.Errorf("expected %s, actual %s", "eyJhbG******", maskToken("eyJhbGciOiJIUzI1NiJ9.secret"))
+	}
+}
+
+func TestOAuthLogin(t *testing.T) {
+	grants := testOAuth(t, "authorization_code")
+	if _, err := oauthToken(newReq(), "api", false, false); err == nil || len(grants()) != 0 {
+		t.Errorf("expected error, actual %v %v", err, grants())
+	}
+}
@@ -0,0 +1,649 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	prompt "github.com/c-bata/go-prompt"
+	"github.com/manifoldco/promptui"
+	"gopkg.in/yaml.v3"
+)
+
+// api is the loaded OpenAPI 3 / Swagger 2 document
+var api *apiSpec
+
+type apiSpec struct {
+	doc        interface{}
+	baseURL    string
+	operations []*apiOperation
+}
+
+type apiOperation struct {
+	OperationID string          `json:"operationId"`
+	Summary     string          `json:"summary"`
+	Description string          `json:"description"`
+	Parameters  []*apiParameter `json:"parameters"`
+	RequestBody *apiRequestBody `json:"requestBody"`
+	Consumes    []string        `json:"consumes"`
+
+	Method string `json:"-"`
+	Path   string `json:"-"`
+}
+
+type apiParameter struct {
+	Ref         string        `json:"$ref"`
+	Name        string        `json:"name"`
+	In          string        `json:"in"`
+	Description string        `json:"description"`
+	Required    bool          `json:"required"`
+	Schema      *apiSchema    `json:"schema"`
+	Type        interface{}   `json:"type"`
+	Format      string        `json:"format"`
+	Example     interface{}   `json:"example"`
+	Default     interface{}   `json:"default"`
+	Enum        []interface{} `json:"enum"`
+	Items       *apiSchema    `json:"items"`
+}
+
+type apiRequestBody struct {
+	Ref      string                  `json:"$ref"`
+	Required bool                    `json:"required"`
+	Content  map[string]apiMediaType `json:"content"`
+}
+
+type apiMediaType struct {
+	Schema  *apiSchema  `json:"schema"`
+	Example interface{} `json:"example"`
+}
+
+type apiSchema struct {
+	Ref         string                `json:"$ref"`
+	Type        interface{}           `json:"type"`
+	Format      string                `json:"format"`
+	Description string                `json:"description"`
+	Properties  map[string]*apiSchema `json:"properties"`
+	Items       *apiSchema            `json:"items"`
+	Required    []string              `json:"required"`
+	Example     interface{}           `json:"example"`
+	Default     interface{}           `json:"default"`
+	Enum        []interface{}         `json:"enum"`
+	AllOf       []*apiSchema          `json:"allOf"`
+	OneOf       []*apiSchema          `json:"oneOf"`
+	AnyOf       []*apiSchema          `json:"anyOf"`
+}
+
+func (o *apiOperation) String() string {
+	s := fmt.Sprintf("%-7s %s", o.Method, o.Path)
+	if o.Summary != "" {
+		s += "  " + o.Summary
+	}
+	return s
+}
+
+// openapi <file|url>
+func openapiCommand(args []string) {
+	if len(args) != 1 {
+		fmt.Println("openapi <file|url>")
+		return
+	}
+	var content []byte
+	if strings.HasPrefix(args[0], "http://") || strings.HasPrefix(args[0], "https://") {
+		// the $proxy, TLS settings and timeout of the requests
+		client, err := newClient(req)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		resp, err := client.Get(args[0])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		content, err = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+	} else {
+		content = readFile(args[0])
+	}
+	if len(content) == 0 {
+		return
+	}
+	spec, err := parseOpenAPI(content)
+	if err != nil {
+		fmt.Println("Load", args[0], err)
+		return
+	}
+	api = spec
+	for _, op := range api.operations {
+		if op.OperationID != "" {
+			suggest.AddSuggest(op.OperationID)
+		}
+	}
+	fmt.Printf("> Load %d operations from `%s`\n", len(api.operations), args[0])
+}
+
+// op [operationId|METHOD path], scaffolds req from an operation
+func opCommand(args []string) {
+	if api == nil {
+		fmt.Println("No API loaded, use `openapi <file|url>` first")
+		return
+	}
+	var op *apiOperation
+	if len(args) == 0 {
+		sel := promptui.Select{Label: "Operation: ", Items: api.operations, Size: 10, StartInSearchMode: true}
+		sel.Searcher = func(input string, index int) bool {
+			o := api.operations[index]
+			return fuzzyMatch(o.String()+" "+o.OperationID, input)
+		}
+		idx, _, err := sel.Run()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		op = api.operations[idx]
+	} else {
+		for _, o := range api.operations {
+			if o.OperationID == args[0] || len(args) == 2 && strings.EqualFold(o.Method, args[0]) && o.Path == args[1] {
+				op = o
+				break
+			}
+		}
+		if op == nil {
+			fmt.Printf("`%s` not found\n", strings.Join(args, " "))
+			return
+		}
+	}
+	r, err := api.scaffold(op)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if r.Proxy == "" {
+		r.Proxy = req.Proxy
+	}
+	req = r
+	changePrefix()
+}
+
+func parseOpenAPI(content []byte) (*apiSpec, error) {
+	var doc interface{}
+	if err := json.Unmarshal(content, &doc); err != nil {
+		if err = yaml.Unmarshal(content, &doc); err != nil {
+			return nil, err
+		}
+		doc = normalizeYAML(doc)
+	}
+	root, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("not an OpenAPI document")
+	}
+	if root["openapi"] == nil && root["swagger"] == nil {
+		return nil, fmt.Errorf("missing `openapi` or `swagger` version")
+	}
+	spec := &apiSpec{doc: doc}
+
+	// base URL
+	if servers, ok := root["servers"].([]interface{}); ok && len(servers) > 0 {
+		if s, ok := servers[0].(map[string]interface{}); ok {
+			spec.baseURL, _ = s["url"].(string)
+		}
+	} else if host, ok := root["host"].(string); ok {
+		s := "http"
+		if schemes, ok := root["schemes"].([]interface{}); ok && len(schemes) > 0 {
+			s = fmt.Sprint(schemes[0])
+		}
+		basePath, _ := root["basePath"].(string)
+		spec.baseURL = s + "://" + host + basePath
+	} else if basePath, ok := root["basePath"].(string); ok {
+		spec.baseURL = basePath
+	}
+
+	paths, _ := root["paths"].(map[string]interface{})
+	for _, path := range sortedMapKeys(paths) {
+		item, ok := paths[path].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		var common []*apiParameter
+		spec.decode(item["parameters"], &common)
+		for _, method := range HTTPMethods {
+			v, ok := item[strings.ToLower(method)]
+			if !ok {
+				continue
+			}
+			op := &apiOperation{Method: method, Path: path}
+			if err := spec.decode(v, op); err != nil {
+				return nil, fmt.Errorf("%s %s: %v", method, path, err)
+			}
+			op.Parameters = spec.mergeParameters(common, op.Parameters)
+			spec.operations = append(spec.operations, op)
+		}
+	}
+	return spec, nil
+}
+
+// normalizeYAML converts map[interface{}]interface{} produced for non string
+// keys (eg. response codes) so the document can be encoded as JSON
+func normalizeYAML(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(x))
+		for k, v := range x {
+			m[fmt.Sprint(k)] = normalizeYAML(v)
+		}
+		return m
+	case map[string]interface{}:
+		for k, v := range x {
+			x[k] = normalizeYAML(v)
+		}
+	case []interface{}:
+		for i := range x {
+			x[i] = normalizeYAML(x[i])
+		}
+	}
+	return v
+}
+
+func sortedMapKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// decode converts a generic document node into v
+func (s *apiSpec) decode(node interface{}, v interface{}) error {
+	if node == nil {
+		return nil
+	}
+	b, err := json.Marshal(node)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// lookup resolves a local JSON pointer such as #/components/schemas/User
+func (s *apiSpec) lookup(ref string) interface{} {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil
+	}
+	node := s.doc
+	for _, p := range strings.Split(ref[2:], "/") {
+		p = strings.NewReplacer("~1", "/", "~0", "~").Replace(p)
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		node = m[p]
+	}
+	return node
+}
+
+func (s *apiSpec) mergeParameters(common, params []*apiParameter) []*apiParameter {
+	var l []*apiParameter
+	seen := make(map[string]bool)
+	for _, p := range append(params, common...) {
+		if p.Ref != "" {
+			var r apiParameter
+			if s.decode(s.lookup(p.Ref), &r) != nil || r.Name == "" {
+				continue
+			}
+			p = &r
+		}
+		if seen[p.In+p.Name] {
+			continue
+		}
+		seen[p.In+p.Name] = true
+		l = append(l, p)
+	}
+	return l
+}
+
+func (s *apiSpec) schema(sc *apiSchema) *apiSchema {
+	for i := 0; sc != nil && sc.Ref != "" && i < 10; i++ {
+		var r apiSchema
+		if s.decode(s.lookup(sc.Ref), &r) != nil {
+			return nil
+		}
+		sc = &r
+	}
+	return sc
+}
+
+func (sc *apiSchema) typ() string {
+	switch t := sc.Type.(type) {
+	case string:
+		return t
+	case []interface{}:
+		for _, x := range t {
+			if x != "null" {
+				return fmt.Sprint(x)
+			}
+		}
+	}
+	if len(sc.Properties) > 0 {
+		return "object"
+	}
+	return ""
+}
+
+// example generates an example value of sc
+func (s *apiSpec) example(sc *apiSchema, depth int) interface{} {
+	sc = s.schema(sc)
+	if sc == nil || depth > 6 {
+		return nil
+	}
+	if sc.Example != nil {
+		return sc.Example
+	}
+	if sc.Default != nil {
+		return sc.Default
+	}
+	if len(sc.Enum) > 0 {
+		return sc.Enum[0]
+	}
+	if len(sc.AllOf) > 0 {
+		m := make(map[string]interface{})
+		for _, x := range sc.AllOf {
+			if o, ok := s.example(x, depth+1).(map[string]interface{}); ok {
+				for k, v := range o {
+					m[k] = v
+				}
+			}
+		}
+		return m
+	}
+	if len(sc.OneOf) > 0 {
+		return s.example(sc.OneOf[0], depth+1)
+	}
+	if len(sc.AnyOf) > 0 {
+		return s.example(sc.AnyOf[0], depth+1)
+	}
+	switch sc.typ() {
+	case "object":
+		m := make(map[string]interface{})
+		for k, p := range sc.Properties {
+			m[k] = s.example(p, depth+1)
+		}
+		return m
+	case "array":
+		return []interface{}{s.example(sc.Items, depth+1)}
+	case "integer":
+		return 0
+	case "number":
+		return 0.0
+	case "boolean":
+		return false
+	case "string":
+		switch sc.Format {
+		case "date-time":
+			return time.Now().UTC().Format(time.RFC3339)
+		case "date":
+			return time.Now().UTC().Format("2006-01-02")
+		case "uuid":
+			return "00000000-0000-0000-0000-000000000000"
+		case "email":
+			return "user@example.com"
+		case "uri", "url":
+			return "http://example.com"
+		}
+		return "string"
+	}
+	return nil
+}
+
+func (p *apiParameter) schema() *apiSchema {
+	if p.Schema != nil {
+		return p.Schema
+	}
+	return &apiSchema{Type: p.Type, Format: p.Format, Example: p.Example, Default: p.Default, Enum: p.Enum, Items: p.Items}
+}
+
+func (p *apiParameter) example(s *apiSpec) string {
+	if p.Example != nil {
+		return fmt.Sprint(p.Example)
+	}
+	v := s.example(p.schema(), 0)
+	if v == nil {
+		return ""
+	}
+	if str, ok := v.(string); ok {
+		return str
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// body returns the media type and schema of the request body
+func (s *apiSpec) body(op *apiOperation) (string, *apiSchema) {
+	if rb := op.RequestBody; rb != nil {
+		if rb.Ref != "" {
+			var r apiRequestBody
+			if s.decode(s.lookup(rb.Ref), &r) != nil {
+				return "", nil
+			}
+			rb = &r
+		}
+		for _, mt := range []string{"application/json", "application/x-www-form-urlencoded", "multipart/form-data"} {
+			if c, ok := rb.Content[mt]; ok {
+				if c.Example != nil {
+					return mt, &apiSchema{Example: c.Example}
+				}
+				return mt, c.Schema
+			}
+		}
+		for mt, c := range rb.Content {
+			return mt, c.Schema
+		}
+	}
+	// swagger 2
+	form := &apiSchema{Type: "object", Properties: make(map[string]*apiSchema)}
+	for _, p := range op.Parameters {
+		switch p.In {
+		case "body":
+			return "application/json", p.Schema
+		case "formData":
+			form.Properties[p.Name] = p.schema()
+			if p.Required {
+				form.Required = append(form.Required, p.Name)
+			}
+		}
+	}
+	if len(form.Properties) > 0 {
+		for _, c := range op.Consumes {
+			if c == "multipart/form-data" {
+				return c, form
+			}
+		}
+		return "application/x-www-form-urlencoded", form
+	}
+	return "", nil
+}
+
+func (s *apiSpec) scaffold(op *apiOperation) (*Request, error) {
+	base := s.baseURL
+	if !strings.Contains(base, "://") {
+		host := scheme + "://localhost"
+		if req.URL != nil {
+			host = req.URL.Scheme + "://" + req.URL.Host
+		}
+		base = host + base
+	}
+	path := op.Path
+	r := newReq()
+	r.Method = op.Method
+	for _, p := range op.Parameters {
+		switch p.In {
+		case "path":
+			// a {{name}} placeholder unless the example is a real value, it
+			// is resolved on send
+			v := "{{" + p.Name + "}}"
+			if _, ok := lookupVar(p.Name); !ok {
+				if e := p.example(s); e != "" && e != "0" && e != "string" {
+					v = url.PathEscape(e)
+				}
+			}
+			path = strings.Replace(path, "{"+p.Name+"}", v, -1)
+		case "query":
+			if p.Required {
+				r.Values.Set(p.Name, p.example(s))
+			}
+		case "header":
+			if p.Required {
+				r.Header.Set(p.Name, p.example(s))
+			}
+		}
+	}
+	raw := strings.TrimSuffix(base, "/") + path
+	if strings.Contains(raw, "{{") {
+		r.RawURL, raw = raw, expand(raw)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	r.URL = u
+
+	mt, sc := s.body(op)
+	switch {
+	case strings.Contains(mt, "json"):
+		if v := s.example(sc, 0); v != nil {
+			b, _ := json.Marshal(v)
+			r.Body.Write(b)
+		}
+	case mt == "application/x-www-form-urlencoded" || mt == "multipart/form-data":
+		r.JSON = false
+		r.Form = true
+		r.Multipart = mt == "multipart/form-data"
+		if sc = s.schema(sc); sc != nil {
+			for _, name := range sc.Required {
+				if p := sc.Properties[name]; p != nil {
+					if p.Format == "binary" {
+						fmt.Printf("> Set the file of %s, eg: %s@/path/to/file\n", name, name)
+						continue
+					}
+				}
+				r.Fields.Set(name, fmt.Sprint(s.example(sc.Properties[name], 0)))
+			}
+		}
+	}
+	return r, nil
+}
+
+// match returns the operation whose path template matches u
+func (s *apiSpec) match(method string, u *url.URL) *apiOperation {
+	base, _ := url.Parse(s.baseURL)
+	path := u.Path
+	if base != nil {
+		path = strings.TrimPrefix(path, strings.TrimSuffix(base.Path, "/"))
+	}
+	segs := strings.Split(strings.Trim(path, "/"), "/")
+	var found *apiOperation
+	for _, op := range s.operations {
+		tpl := strings.Split(strings.Trim(op.Path, "/"), "/")
+		if len(tpl) != len(segs) {
+			continue
+		}
+		ok := true
+		for i := range tpl {
+			if tpl[i] != segs[i] && !strings.HasPrefix(tpl[i], "{") {
+				ok = false
+				break
+			}
+		}
+		if !ok {
+			continue
+		}
+		if op.Method == method {
+			return op
+		}
+		if found == nil {
+			found = op
+		}
+	}
+	return found
+}
+
+// suggest returns paths, operations and, for the operation matching r,
+// its parameters and body properties
+func (s *apiSpec) suggest(r *Request) []prompt.Suggest {
+	var l []prompt.Suggest
+	seen := make(map[string]int)
+	for _, op := range s.operations {
+		if i, ok := seen[op.Path]; ok {
+			l[i].Description += ", " + op.Method + " " + op.Summary
+		} else {
+			seen[op.Path] = len(l)
+			l = append(l, prompt.Suggest{Text: op.Path, Description: op.Method + " " + op.Summary})
+		}
+		if op.OperationID != "" {
+			l = append(l, prompt.Suggest{Text: op.OperationID, Description: op.Method + " " + op.Path})
+		}
+	}
+	if r.URL == nil {
+		return l
+	}
+	op := s.match(r.Method, r.URL)
+	if op == nil {
+		return l
+	}
+	for _, m := range s.operations {
+		if m.Path == op.Path {
+			l = append(l, prompt.Suggest{Text: m.Method, Description: m.Summary})
+		}
+	}
+	for _, p := range op.Parameters {
+		desc := p.In + ": " + p.Description
+		if p.Required {
+			desc += " (required)"
+		}
+		switch p.In {
+		case "query":
+			l = append(l, prompt.Suggest{Text: p.Name + "==", Description: desc})
+		case "header":
+			l = append(l, prompt.Suggest{Text: p.Name + ":", Description: desc})
+		}
+	}
+	_, sc := s.body(op)
+	if sc = s.schema(sc); sc != nil {
+		required := make(map[string]bool)
+		for _, name := range sc.Required {
+			required[name] = true
+		}
+		for _, name := range sortedSchemaKeys(sc.Properties) {
+			p := s.schema(sc.Properties[name])
+			if p == nil {
+				continue
+			}
+			text := name + "="
+			if t := p.typ(); t != "string" && t != "" {
+				text = name + "=:"
+			}
+			desc := "body: " + p.typ() + " " + p.Description
+			if required[name] {
+				desc += " (required)"
+			}
+			l = append(l, prompt.Suggest{Text: text, Description: desc})
+		}
+	}
+	return l
+}
+
+func sortedSchemaKeys(m map[string]*apiSchema) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
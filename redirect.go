@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/fatih/color"
+)
+
+// defaultRedirects is the limit of `$redirects=follow`, the same as net/http
+const defaultRedirects = 10
+
+// checkRedirect applies the redirect settings of r and prints each hop
+// unless r is a bench
+func checkRedirect(r *Request) func(*http.Request, []*http.Request) error {
+	return func(next *http.Request, via []*http.Request) error {
+		if r.Redirects < 0 {
+			return http.ErrUseLastResponse
+		}
+		// the hop over the limit is printed too, it tells where it goes
+		if next.Response != nil && !r.Bench {
+			printHop(via[len(via)-1], next.Response)
+		}
+		limit := r.Redirects
+		if limit == 0 {
+			limit = defaultRedirects
+		}
+		if len(via) > limit {
+			return fmt.Errorf("stopped after %d redirects", limit)
+		}
+
+		first, prev := via[0], via[len(via)-1]
+		// net/http drops Authorization when the host changes
+		if r.KeepAuth && next.Header.Get("Authorization") == "" {
+			if auth := first.Header.Get("Authorization"); auth != "" {
+				next.Header.Set("Authorization", auth)
+			}
+		}
+		// 307 and 308 keep the method and body already, 301, 302 and 303
+		// turn them into a GET without body
+		if r.KeepMethod && next.Method != prev.Method {
+			if prev.GetBody == nil && prev.Body != nil && prev.Body != http.NoBody {
+				return fmt.Errorf("$keepmethod cannot send the body of %s %s again", prev.Method, prev.URL)
+			}
+			next.Method = prev.Method
+			if prev.GetBody != nil {
+				body, err := prev.GetBody()
+				if err != nil {
+					return err
+				}
+				next.Body, next.GetBody, next.ContentLength = body, prev.GetBody, prev.ContentLength
+				if ct := prev.Header.Get("Content-Type"); ct != "" {
+					next.Header.Set("Content-Type", ct)
+				}
+			}
+		}
+		return nil
+	}
+}
+
+func printHop(from *http.Request, resp *http.Response) {
+	c := color.New(color.FgYellow)
+	c.Printf("> %s %s", resp.Status, from.URL)
+	fmt.Printf(" -> %s\n", resp.Header.Get("Location"))
+	for _, cookie := range resp.Header["Set-Cookie"] {
+		fmt.Printf("  Set-Cookie: %s\n", cookie)
+	}
+}
+
+// parseRedirects parses follow, none or the max number of redirects
+func parseRedirects(value string) (int, error) {
+	switch value {
+	case "follow", "":
+		return 0, nil
+	case "none", "0":
+		return -1, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("$redirects=follow|none|{max}, eg: $redirects=3")
+	}
+	return n, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseRedirects(t *testing.T) {
+	cases := map[string]int{"follow": 0, "none": -1, "0": -1, "3": 3}
+	for in, expected := range cases {
+		actual, err := parseRedirects(in)
+		if err != nil || actual != expected {
+			t.Errorf("expected %v, actual %v %v", expected, actual, err)
+		}
+	}
+	if _, err := parseRedirects("-2"); err == nil {
+		t.Errorf("expected error, actual nil")
+	}
+}
+
+func TestKeepMethod(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusFound)
+			return
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		w.Write([]byte(r.Method + " " + string(b)))
+	}))
+	defer ts.Close()
+	client := &http.Client{CheckRedirect: checkRedirect(&Request{KeepMethod: true, Bench: true})}
+
+	r, _ := http.NewRequest("POST", ts.URL+"/old", strings.NewReader("a=1"))
+	resp, err := client.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(b) != "POST a=1" {
+		t.Errorf("expected %v, actual %v", "POST a=1", string(b))
+	}
+
+	// a body read once cannot follow the redirect
+	r, _ = http.NewRequest("POST", ts.URL+"/old", io.MultiReader(strings.NewReader("a=1")))
+	if _, err = client.Do(r); err == nil {
+		t.Errorf("expected error, actual nil")
+	}
+}
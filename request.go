@@ -32,22 +32,36 @@ var (
 	//HTTPMethods is this http methods list
 	HTTPMethods = []string{GET, POST, PUT, DELETE, PATCH, HEAD, OPTIONS}
 	regHeader   = regexp.MustCompile(`([a-zA-Z0-9-_]+:\s)(.+)`)
-	regStatus   = regexp.MustCompile(`(HTTP/1\.1) (([2345])\d{2})`)
+	regStatus   = regexp.MustCompile(`(HTTP/[\d.]+) (([2345])\d{2})`)
 )
 
 // Request is the http request
 type Request struct {
 	Method          string
 	URL             *url.URL
+	RawURL          string
 	Username        string
 	Password        string
+	AuthType        string
 	Proxy           string
+	TLS             TLSOptions
+	TLSInfo         bool
+	Trace           bool
+	Proto           string
+	Redirects       int
+	KeepAuth        bool
+	KeepMethod      bool
+	OAuth           string
 	JSON            bool
 	Form            bool
+	Multipart       bool
 	Bench           bool
 	Call            bool
 	NumberOfRequest uint64
 	Concurrency     uint64
+	Rate            float64
+	Stages          []benchStage
+	RunName         string
 	Duration        time.Duration
 	Timeout         time.Duration
 	Header          http.Header
@@ -56,7 +70,42 @@ type Request struct {
 	Files           url.Values
 	JSONMap         map[string][]interface{}
 	Body            bytes.Buffer
+	Asserts         []string
+	Captures        map[string]string
+	ResponseStatus  int
+	ResponseHeader  http.Header
 	ResponseBody    []byte
+	ResponseTime    time.Duration
+}
+
+// RequestData is the serializable form of Request
+type RequestData struct {
+	Method   string      `json:"method"`
+	URL      string      `json:"url"`
+	Username string      `json:"username,omitempty"`
+	Password string      `json:"password,omitempty"`
+	AuthType string      `json:"auth_type,omitempty"`
+	Proxy    string      `json:"proxy,omitempty"`
+	TLS      *TLSOptions `json:"tls,omitempty"`
+	Proto    string      `json:"proto,omitempty"`
+	// Redirects is the max number of redirects, 0 follows up to 10 and
+	// -1 none
+	Redirects  int                      `json:"redirects,omitempty"`
+	KeepAuth   bool                     `json:"keep_auth,omitempty"`
+	KeepMethod bool                     `json:"keep_method,omitempty"`
+	OAuth      string                   `json:"oauth,omitempty"`
+	JSON       bool                     `json:"json"`
+	Form       bool                     `json:"form"`
+	Multipart  bool                     `json:"multipart,omitempty"`
+	Timeout    time.Duration            `json:"timeout,omitempty"`
+	Header     http.Header              `json:"header,omitempty"`
+	Values     url.Values               `json:"values,omitempty"`
+	Fields     url.Values               `json:"fields,omitempty"`
+	Files      url.Values               `json:"files,omitempty"`
+	JSONMap    map[string][]interface{} `json:"json_map,omitempty"`
+	Body       string                   `json:"body,omitempty"`
+	Asserts    []string                 `json:"asserts,omitempty"`
+	Captures   map[string]string        `json:"captures,omitempty"`
 }
 
 func (r Request) String() string {
@@ -64,7 +113,121 @@ func (r Request) String() string {
 }
 
 func newReq() *Request {
-	return &Request{Header: make(http.Header), Values: make(url.Values), Files: make(url.Values), Fields: make(url.Values), JSON: true, JSONMap: make(map[string][]interface{})}
+	return &Request{Header: make(http.Header), Values: make(url.Values), Files: make(url.Values), Fields: make(url.Values), JSON: true, JSONMap: make(map[string][]interface{}), Captures: make(map[string]string)}
+}
+
+func (r *Request) data() RequestData {
+	d := RequestData{
+		Method:     r.Method,
+		Username:   r.Username,
+		Password:   r.Password,
+		AuthType:   r.AuthType,
+		Proxy:      r.Proxy,
+		Proto:      r.Proto,
+		Redirects:  r.Redirects,
+		KeepAuth:   r.KeepAuth,
+		KeepMethod: r.KeepMethod,
+		OAuth:      r.OAuth,
+		JSON:       r.JSON,
+		Form:       r.Form,
+		Multipart:  r.Multipart,
+		Timeout:    r.Timeout,
+		Header:     make(http.Header),
+		Values:     make(url.Values),
+		Fields:     make(url.Values),
+		Files:      make(url.Values),
+		JSONMap:    make(map[string][]interface{}),
+		Body:       r.Body.String(),
+		Asserts:    append([]string(nil), r.Asserts...),
+		Captures:   make(map[string]string),
+	}
+	for k, v := range r.Captures {
+		d.Captures[k] = v
+	}
+	copyValues(d.Header, r.Header)
+	copyValues(d.Values, r.Values)
+	copyValues(d.Fields, r.Fields)
+	copyValues(d.Files, r.Files)
+	for k, v := range r.JSONMap {
+		d.JSONMap[k] = append([]interface{}(nil), v...)
+	}
+	d.URL = r.rawURL()
+	if !r.TLS.empty() {
+		t := r.TLS
+		t.Ciphers = append([]string(nil), t.Ciphers...)
+		d.TLS = &t
+	}
+	return d
+}
+
+func (d RequestData) request() (*Request, error) {
+	r := newReq()
+	if d.URL != "" {
+		raw := d.URL
+		if strings.Contains(raw, "{{") {
+			r.RawURL, raw = raw, expand(raw)
+		}
+		u, err := url.Parse(raw)
+		if err != nil {
+			return nil, err
+		}
+		r.URL = u
+	}
+	r.Method = d.Method
+	r.Username = d.Username
+	r.Password = d.Password
+	r.AuthType = d.AuthType
+	r.Proxy = d.Proxy
+	if d.TLS != nil {
+		r.TLS = *d.TLS
+		r.TLS.Ciphers = append([]string(nil), d.TLS.Ciphers...)
+	}
+	r.Proto = d.Proto
+	r.Redirects = d.Redirects
+	r.KeepAuth = d.KeepAuth
+	r.KeepMethod = d.KeepMethod
+	r.OAuth = d.OAuth
+	r.JSON = d.JSON
+	r.Form = d.Form
+	r.Multipart = d.Multipart
+	r.Timeout = d.Timeout
+	r.Body.WriteString(d.Body)
+	r.Asserts = append([]string(nil), d.Asserts...)
+	for k, v := range d.Captures {
+		r.Captures[k] = v
+	}
+	copyValues(r.Header, d.Header)
+	copyValues(r.Values, d.Values)
+	copyValues(r.Fields, d.Fields)
+	copyValues(r.Files, d.Files)
+	for k, v := range d.JSONMap {
+		r.JSONMap[k] = append([]interface{}(nil), v...)
+	}
+	return r, nil
+}
+
+// rawURL is the URL as typed, RawURL is set when it has {{placeholders}}
+// and URL is resolved with the environment of the time
+func (r *Request) rawURL() string {
+	if r.RawURL != "" {
+		return r.RawURL
+	}
+	if r.URL != nil {
+		return r.URL.String()
+	}
+	return ""
+}
+
+// expandVars returns a copy of r with the {{name}} placeholders resolved,
+// r keeps them so saved requests follow `env` switches and hold no secrets
+func (r *Request) expandVars() (*Request, error) {
+	return r.data().expandWith(expand).request()
+}
+
+func copyValues(dst, src map[string][]string) {
+	for k, v := range src {
+		dst[k] = append([]string(nil), v...)
+	}
 }
 
 func (r *Request) reset() {
@@ -74,27 +237,35 @@ func (r *Request) reset() {
 	r.Files = make(url.Values)
 	r.Values = make(url.Values)
 	r.JSONMap = make(map[string][]interface{})
-
+	r.Asserts = nil
+	r.Captures = make(map[string]string)
 }
 
 func (r *Request) newHTTPRequest() (httpReq *http.Request, err error) {
 	if r.URL == nil {
 		return nil, fmt.Errorf("URL not set")
 	}
+	if r, err = r.expandVars(); err != nil {
+		return nil, err
+	}
 	var _URL = r.URL.String()
 	if len(r.Values) != 0 {
 		_URL += "?" + r.Values.Encode()
 	}
-	r.Header.Set("Content-Type", "application/json; charset=UTF-8")
-	r.Header.Set("Accept", "application/json")
+	if r.Header.Get("Content-Type") == "" {
+		r.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	}
+	if r.Header.Get("Accept") == "" {
+		r.Header.Set("Accept", "application/json")
+	}
 
 	if r.Method == POST || r.Method == PUT || r.Method == PATCH {
 		var body io.Reader
-		if req.Body.Len() > 0 {
-			body = bytes.NewReader(req.Body.Bytes())
+		if r.Body.Len() > 0 {
+			body = bytes.NewReader(r.Body.Bytes())
 		} else if len(r.JSONMap) > 0 && r.JSON {
 			body = r.jsonBody()
-		} else if len(r.Files) > 0 {
+		} else if len(r.Files) > 0 || r.Multipart {
 			pipeReader, pipeWriter := io.Pipe()
 			bodyWriter := multipart.NewWriter(pipeWriter)
 			go func() {
@@ -103,10 +274,12 @@ func (r *Request) newHTTPRequest() (httpReq *http.Request, err error) {
 						fileWriter, err := bodyWriter.CreateFormFile(param, file)
 						if err != nil {
 							req.error(err)
+							continue
 						}
 						f, err := os.Open(file)
 						if err != nil {
 							req.error(err)
+							continue
 						}
 						_, err = io.Copy(fileWriter, f)
 						f.Close()
@@ -138,17 +311,38 @@ func (r *Request) newHTTPRequest() (httpReq *http.Request, err error) {
 			fmt.Println(err)
 			return
 		}
+	} else {
+		httpReq, err = http.NewRequest(r.Method, _URL, nil)
+		if err != nil {
+			return
+		}
 	}
-	if r.Method == GET || r.Method == DELETE || r.Method == OPTIONS {
-		httpReq, _ = http.NewRequest(r.Method, _URL, nil)
-	}
-	if r.Username != "" {
+	httpReq.Header = r.Header.Clone()
+	if r.Username != "" && r.AuthType != "digest" {
 		httpReq.SetBasicAuth(r.Username, r.Password)
 	}
-	httpReq.Header = r.Header
 	return
 }
 
+// authorize sets the digest or OAuth Authorization header of httpReq, these
+// change state so they are left out of newHTTPRequest, which also serves
+// exports. login allows the browser login of an OAuth profile.
+func (r *Request) authorize(httpReq *http.Request, login bool) error {
+	if r.Username != "" && r.AuthType == "digest" {
+		if err := digestAuth(httpReq, expand(r.Username), expand(r.Password)); err != nil {
+			return err
+		}
+	}
+	if r.OAuth != "" {
+		tok, err := oauthToken(r, r.OAuth, false, login)
+		if err != nil {
+			return err
+		}
+		httpReq.Header.Set("Authorization", tok.Type()+" "+tok.AccessToken)
+	}
+	return nil
+}
+
 func (r *Request) jsonBody() io.Reader {
 	js := make(map[string]interface{})
 
@@ -174,12 +368,12 @@ func (r *Request) jsonBody() io.Reader {
 
 func (r *Request) errorf(format string, a ...interface{}) {
 	r.Call = false
-	fmt.Printf(format, a...)
+	fmt.Fprintf(errOut, format, a...)
 }
 
 func (r *Request) error(err ...interface{}) {
 	r.Call = false
-	fmt.Println(err...)
+	fmt.Fprintln(errOut, err...)
 }
 
 func colorize(dump []byte) string {
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+const scriptDelimiter = "---"
+
+// blockVars are the {{name}} variables set by %var in the current script block
+var blockVars map[string]string
+
+// script runs a file of request blocks, lines are parsed like prompt input
+//
+//	// comment
+//	%bail                stop at the first failed request
+//	%include other.http  run another script, relative to this one
+//	POST :8080/login
+//	user=a pass={{password}}
+//	?status==200
+//	%send                send the request, failed assertions fail the script,
+//	                     so does a status >= 400 unless ?status checks it
+//	---                  start a new request block, in an included file it
+//	                     ends with the file
+//	%var id=3            variable of this block only
+//	GET :8080/users/{{id}}
+//	%send
+type script struct {
+	bail   bool
+	sent   int
+	failed int
+	depth  int
+}
+
+// runScript runs filename and returns the number of failures
+func runScript(filename string) int {
+	s := &script{}
+	// requests of a script never pop up the history selection, the block
+	// running it with !file goes on with its own variables
+	defer func(b bool, vars map[string]string) { interactive, blockVars = b, vars }(interactive, blockVars)
+	interactive = false
+	vars := make(map[string]string, len(blockVars))
+	for k, v := range blockVars {
+		vars[k] = v
+	}
+	blockVars = vars
+	s.run(filename)
+	if s.sent > 0 || s.failed > 0 {
+		fmt.Printf("> `%s` %d sent, %d failed\n", filename, s.sent, s.failed)
+	}
+	return s.failed
+}
+
+// run executes filename, it returns true when the script has to stop
+func (s *script) run(filename string) bool {
+	if s.depth > 10 {
+		fmt.Printf("> Include `%s` too deep\n", filename)
+		s.failed++
+		return true
+	}
+	content := readFile(filename)
+	if content == nil {
+		s.failed++
+		return s.bail
+	}
+	fmt.Printf("> Load file `%s`\n", filename)
+	s.depth++
+	// a block started by an included file ends with it, the including
+	// block goes on with its own request and variables
+	parentReq, parentVars, reset := req, blockVars, false
+	defer func() {
+		s.depth--
+		if reset && s.depth > 0 {
+			req, blockVars = parentReq, parentVars
+		}
+	}()
+
+	sc := bufio.NewScanner(bytes.NewReader(content))
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for n := 1; sc.Scan(); n++ {
+		l := strings.TrimSpace(sc.Text())
+		switch {
+		case l == "" || strings.HasPrefix(l, "//"):
+			continue
+		case l == scriptDelimiter:
+			r := newReq()
+			r.Proxy = req.Proxy
+			req = r
+			blockVars = nil
+			reset = true
+		case strings.HasPrefix(l, "%"):
+			fmt.Println(">", l)
+			if s.directive(filepath.Dir(filename), l[1:]) {
+				return true
+			}
+		default:
+			fmt.Println(">", l)
+			req.Call = true
+			parseInput(l)
+			if !req.Call {
+				fmt.Printf("> %s:%d failed\n", filename, n)
+				if s.fail() {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (s *script) directive(dir, l string) bool {
+	fields := strings.Fields(l)
+	if len(fields) == 0 {
+		return false
+	}
+	args := fields[1:]
+	switch fields[0] {
+	case "send":
+		s.sent++
+		fails := assertFailures
+		req.ResponseStatus = 0
+		if err := doRequest(); err != nil || assertFailures > fails {
+			return s.fail()
+		}
+		if req.ResponseStatus >= 400 && !assertsStatus(req) {
+			fmt.Printf("> Status %d failed\n", req.ResponseStatus)
+			return s.fail()
+		}
+	case "include":
+		if len(args) != 1 {
+			fmt.Printf("%%include <file>\n")
+			return s.fail()
+		}
+		filename := expand(args[0])
+		if !filepath.IsAbs(filename) {
+			filename = filepath.Join(dir, filename)
+		}
+		return s.run(filename)
+	case "var":
+		for _, arg := range args {
+			pair := strings.SplitN(arg, "=", 2)
+			if len(pair) != 2 || pair[0] == "" {
+				fmt.Printf("%%var <key>=<value>\n")
+				return s.fail()
+			}
+			if blockVars == nil {
+				blockVars = make(map[string]string)
+			}
+			blockVars[pair[0]] = expand(pair[1])
+		}
+	case "bail":
+		s.bail = true
+	default:
+		fmt.Printf("unknown directive `%%%s`\n", fields[0])
+		return s.fail()
+	}
+	return false
+}
+
+// assertsStatus reports whether r checks the response status itself
+func assertsStatus(r *Request) bool {
+	for _, expr := range r.Asserts {
+		if a, err := parseAssert(expr); err == nil && a.Target == "status" {
+			return true
+		}
+	}
+	return false
+}
+
+// fail records a failure and reports whether the script stops
+func (s *script) fail() bool {
+	s.failed++
+	if s.bail {
+		fmt.Println("> Stop at first failure")
+	}
+	return s.bail
+}
@@ -63,6 +63,9 @@ func (s *Suggestion) AddSuggest(param string) {
 
 func (s *Suggestion) Suggest(req *Request) []prompt.Suggest {
 	sort.Sort(s)
+	if api != nil {
+		return append(api.suggest(req), s.suggest...)
+	}
 	return s.suggest
 }
 
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// TLSOptions configures the TLS client of a request, options of the
+// active environment apply when the request leaves them empty
+type TLSOptions struct {
+	Cert           string   `json:"cert,omitempty"`
+	Key            string   `json:"key,omitempty"`
+	PKCS12         string   `json:"pkcs12,omitempty"`
+	PKCS12Password string   `json:"pkcs12_password,omitempty"`
+	CA             string   `json:"ca,omitempty"`
+	Insecure       bool     `json:"insecure,omitempty"`
+	ServerName     string   `json:"server_name,omitempty"`
+	MinVersion     string   `json:"min_version,omitempty"`
+	MaxVersion     string   `json:"max_version,omitempty"`
+	Ciphers        []string `json:"ciphers,omitempty"`
+	// Pins are sha256/<base64> hashes of accepted public keys
+	Pins []string `json:"pins,omitempty"`
+}
+
+func isTLSVariable(key string) bool {
+	switch key {
+	case "$cert", "$key", "$p12", "$p12pass", "$cacert", "$insecure", "$servername", "$tlsmin", "$tlsmax", "$ciphers", "$pin":
+		return true
+	}
+	return false
+}
+
+// set applies a TLS variable, eg: $cert=client.pem $tlsmin=1.2
+func (o *TLSOptions) set(key, value string) error {
+	switch key {
+	case "$cert":
+		o.Cert = value
+	case "$key":
+		o.Key = value
+	case "$p12":
+		o.PKCS12 = value
+	case "$p12pass":
+		o.PKCS12Password = value
+	case "$cacert":
+		o.CA = value
+	case "$insecure":
+		if value == "" {
+			o.Insecure = true
+			return nil
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("$insecure[=true|false]")
+		}
+		o.Insecure = b
+	case "$servername":
+		o.ServerName = value
+	case "$tlsmin", "$tlsmax":
+		if _, ok := tlsVersions[value]; !ok && value != "" {
+			return fmt.Errorf("%s=1.0|1.1|1.2|1.3", key)
+		}
+		if key == "$tlsmin" {
+			o.MinVersion = value
+		} else {
+			o.MaxVersion = value
+		}
+	case "$ciphers":
+		o.Ciphers = nil
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+			if _, ok := cipherSuite(name); !ok {
+				return fmt.Errorf("unknown cipher suite `%s`", name)
+			}
+			o.Ciphers = append(o.Ciphers, name)
+		}
+	case "$pin":
+		o.Pins = nil
+		for _, pin := range strings.Split(value, ",") {
+			if pin = strings.TrimSpace(pin); pin == "" {
+				continue
+			}
+			pin = strings.Replace(pin, "sha256//", "sha256/", 1)
+			if b, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(pin, "sha256/")); err != nil || len(b) != sha256.Size || !strings.HasPrefix(pin, "sha256/") {
+				return fmt.Errorf("$pin=sha256/<base64>[,...]")
+			}
+			o.Pins = append(o.Pins, pin)
+		}
+	default:
+		return fmt.Errorf("unknown %s", key)
+	}
+	return nil
+}
+
+func (o TLSOptions) empty() bool {
+	return o.Cert == "" && o.Key == "" && o.PKCS12 == "" && o.PKCS12Password == "" && o.CA == "" && !o.Insecure &&
+		o.ServerName == "" && o.MinVersion == "" && o.MaxVersion == "" && len(o.Ciphers) == 0 && len(o.Pins) == 0
+}
+
+// merge fills the options o leaves empty from def
+func (o TLSOptions) merge(def *TLSOptions) TLSOptions {
+	if def == nil {
+		return o
+	}
+	if o.Cert == "" && o.PKCS12 == "" {
+		o.Cert, o.Key = def.Cert, def.Key
+		o.PKCS12, o.PKCS12Password = def.PKCS12, def.PKCS12Password
+	}
+	if o.CA == "" {
+		o.CA = def.CA
+	}
+	o.Insecure = o.Insecure || def.Insecure
+	if o.ServerName == "" {
+		o.ServerName = def.ServerName
+	}
+	if o.MinVersion == "" {
+		o.MinVersion = def.MinVersion
+	}
+	if o.MaxVersion == "" {
+		o.MaxVersion = def.MaxVersion
+	}
+	if len(o.Ciphers) == 0 {
+		o.Ciphers = def.Ciphers
+	}
+	if len(o.Pins) == 0 {
+		o.Pins = def.Pins
+	}
+	return o
+}
+
+// verifyPins checks that a pinned key is in a verified chain, with
+// $insecure there is no verified chain so the leaf must match, the same as
+// curl --pinnedpubkey
+func verifyPins(pins []string, insecure bool) func(tls.ConnectionState) error {
+	var match = func(cert *x509.Certificate) bool {
+		pin := spkiPin(cert)
+		for _, p := range pins {
+			if p == pin {
+				return true
+			}
+		}
+		return false
+	}
+	return func(cs tls.ConnectionState) error {
+		if insecure {
+			if len(cs.PeerCertificates) > 0 && match(cs.PeerCertificates[0]) {
+				return nil
+			}
+		} else {
+			for _, chain := range cs.VerifiedChains {
+				for _, cert := range chain {
+					if match(cert) {
+						return nil
+					}
+				}
+			}
+		}
+		var got []string
+		if len(cs.PeerCertificates) > 0 {
+			got = append(got, spkiPin(cs.PeerCertificates[0]))
+		}
+		return fmt.Errorf("public key pin mismatch, got %s", strings.Join(got, ","))
+	}
+}
+
+func cipherSuite(name string) (uint16, bool) {
+	for _, s := range tls.CipherSuites() {
+		if s.Name == name {
+			return s.ID, true
+		}
+	}
+	for _, s := range tls.InsecureCipherSuites() {
+		if s.Name == name {
+			return s.ID, true
+		}
+	}
+	return 0, false
+}
+
+// config builds the tls.Config of o, nil when nothing is set
+func (o TLSOptions) config() (*tls.Config, error) {
+	if o.empty() {
+		return nil, nil
+	}
+	c := &tls.Config{InsecureSkipVerify: o.Insecure, ServerName: o.ServerName}
+	c.MinVersion = tlsVersions[o.MinVersion]
+	c.MaxVersion = tlsVersions[o.MaxVersion]
+	for _, name := range o.Ciphers {
+		id, ok := cipherSuite(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown cipher suite `%s`", name)
+		}
+		c.CipherSuites = append(c.CipherSuites, id)
+	}
+	if len(o.Pins) > 0 {
+		c.VerifyConnection = verifyPins(o.Pins, o.Insecure)
+	}
+
+	if o.CA != "" {
+		pem, err := ioutil.ReadFile(o.CA)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", o.CA)
+		}
+		c.RootCAs = pool
+	}
+
+	switch {
+	case o.PKCS12 != "":
+		b, err := ioutil.ReadFile(o.PKCS12)
+		if err != nil {
+			return nil, err
+		}
+		key, cert, chain, err := pkcs12.DecodeChain(b, expand(o.PKCS12Password))
+		if err != nil {
+			return nil, fmt.Errorf("%s %v", o.PKCS12, err)
+		}
+		certificate := tls.Certificate{PrivateKey: key, Leaf: cert, Certificate: [][]byte{cert.Raw}}
+		for _, ca := range chain {
+			certificate.Certificate = append(certificate.Certificate, ca.Raw)
+		}
+		c.Certificates = []tls.Certificate{certificate}
+	case o.Cert != "":
+		// the key may be in the same PEM file as the certificate
+		key := o.Key
+		if key == "" {
+			key = o.Cert
+		}
+		certificate, err := tls.LoadX509KeyPair(o.Cert, key)
+		if err != nil {
+			return nil, err
+		}
+		c.Certificates = []tls.Certificate{certificate}
+	}
+	return c, nil
+}
+
+// vars lists the options set in o as variables
+func (o TLSOptions) vars() map[string]string {
+	vars := map[string]string{
+		"$cert":       o.Cert,
+		"$key":        o.Key,
+		"$p12":        o.PKCS12,
+		"$cacert":     o.CA,
+		"$servername": o.ServerName,
+		"$tlsmin":     o.MinVersion,
+		"$tlsmax":     o.MaxVersion,
+		"$ciphers":    strings.Join(o.Ciphers, ","),
+		"$pin":        strings.Join(o.Pins, ","),
+	}
+	if o.PKCS12Password != "" {
+		vars["$p12pass"] = "******"
+	}
+	if o.Insecure {
+		vars["$insecure"] = "true"
+	}
+	for k, v := range vars {
+		if v == "" {
+			delete(vars, k)
+		}
+	}
+	return vars
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestTLSOptions(t *testing.T) {
+	var o TLSOptions
+	for _, kv := range [][2]string{{"$insecure", ""}, {"$tlsmin", "1.2"}, {"$ciphers", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}} {
+		if err := o.set(kv[0], kv[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := o.set("$tlsmax", "1.4"); err == nil {
+		t.Errorf("expected error, actual nil")
+	}
+	if err := o.set("$pin", "sha256/abc"); err == nil {
+		t.Errorf("expected error, actual nil")
+	}
+	if err := o.set("$pin", "sha256//1kSrr2eXl1RraahMgHxWzfg/XqDGxER11cGdsKYBXOI="); err != nil || o.Pins[0] != "sha256/1kSrr2eXl1RraahMgHxWzfg/XqDGxER11cGdsKYBXOI=" {
+		t.Errorf("expected %s, actual %v %v", "sha256/1kSrr2eXl1RraahMgHxWzfg/XqDGxER11cGdsKYBXOI=", o.Pins, err)
+	}
+
+	o = o.merge(&TLSOptions{ServerName: "internal", MinVersion: "1.3", CA: "ca.pem"})
+	if o.ServerName != "internal" || o.MinVersion != "1.2" || o.CA != "ca.pem" {
+		t.Errorf("expected internal 1.2 ca.pem, actual %s %s %s", o.ServerName, o.MinVersion, o.CA)
+	}
+
+	o.CA = ""
+	c, err := o.config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.InsecureSkipVerify || c.MinVersion != tls.VersionTLS12 || len(c.CipherSuites) != 1 {
+		t.Errorf("expected insecure TLS 1.2 with 1 cipher, actual %v %x %v", c.InsecureSkipVerify, c.MinVersion, c.CipherSuites)
+	}
+}
+
+func testCert(t *testing.T, cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: cn}, NotAfter: time.Now().Add(time.Hour), IsCA: true, BasicConstraintsValid: true}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return cert, key
+}
+
+func TestVerifyPins(t *testing.T) {
+	ca, caKey := testCert(t, "ca", nil, nil)
+	leaf, _ := testCert(t, "leaf", ca, caKey)
+	evil, _ := testCert(t, "evil", nil, nil)
+
+	// a leaf of the attacker with the pinned CA appended
+	appended := tls.ConnectionState{PeerCertificates: []*x509.Certificate{evil, ca}}
+	if err := verifyPins([]string{spkiPin(ca)}, false)(appended); err == nil {
+		t.Errorf("expected error, actual nil")
+	}
+	if err := verifyPins([]string{spkiPin(ca)}, true)(appended); err == nil {
+		t.Errorf("expected error, actual nil")
+	}
+
+	verified := tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf, ca}, VerifiedChains: [][]*x509.Certificate{{leaf, ca}}}
+	if err := verifyPins([]string{spkiPin(ca)}, false)(verified); err != nil {
+		t.Errorf("expected nil, actual %v", err)
+	}
+	if err := verifyPins([]string{spkiPin(leaf)}, true)(tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf, ca}}); err != nil {
+		t.Errorf("expected nil, actual %v", err)
+	}
+}
+
+func TestUnverifiedTLS(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{}}}
+	_, err := client.Get(ts.URL)
+	if err == nil {
+		t.Fatal("expected error, actual nil")
+	}
+	cs := unverifiedTLS(client, u, err)
+	if cs == nil || len(cs.PeerCertificates) == 0 || cs.Version == 0 {
+		t.Errorf("expected the handshake, actual %+v", cs)
+	}
+	if cs := unverifiedTLS(client, u, fmt.Errorf("EOF")); cs != nil {
+		t.Errorf("expected nil, actual %+v", cs)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"golang.org/x/crypto/ocsp"
+)
+
+// expiryWarning is how long before expiry a certificate is reported
+const expiryWarning = 30 * 24 * time.Hour
+
+// spkiPin is the sha256/<base64> hash of the public key of cert, the same
+// as curl --pinnedpubkey
+func spkiPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return "sha256/" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	hex := make([]string, len(sum))
+	for i, b := range sum {
+		hex[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(hex, ":")
+}
+
+// keyInfo describes the public key of cert and whether it is weak
+func keyInfo(cert *x509.Certificate) (string, bool) {
+	switch k := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d", k.N.BitLen()), k.N.BitLen() < 2048
+	case *ecdsa.PublicKey:
+		return fmt.Sprintf("ECDSA %s", k.Curve.Params().Name), k.Curve.Params().BitSize < 256
+	case ed25519.PublicKey:
+		return "Ed25519", false
+	}
+	return cert.PublicKeyAlgorithm.String(), false
+}
+
+func sans(cert *x509.Certificate) string {
+	var names []string
+	for _, n := range cert.DNSNames {
+		names = append(names, "DNS:"+n)
+	}
+	for _, ip := range cert.IPAddresses {
+		names = append(names, "IP:"+ip.String())
+	}
+	for _, e := range cert.EmailAddresses {
+		names = append(names, "email:"+e)
+	}
+	for _, u := range cert.URIs {
+		names = append(names, "URI:"+u.String())
+	}
+	return strings.Join(names, ", ")
+}
+
+// printTLS prints the handshake and the peer certificate chain of cs,
+// host is checked against the leaf certificate
+func printTLS(cs *tls.ConnectionState, host string) {
+	bold := color.New(color.Bold)
+	warn := color.New(color.FgHiRed)
+	var warnings []string
+
+	bold.Println("TLS:")
+	fmt.Printf("  Version:  %s\n", tls.VersionName(cs.Version))
+	fmt.Printf("  Cipher:   %s\n", tls.CipherSuiteName(cs.CipherSuite))
+	alpn := cs.NegotiatedProtocol
+	if alpn == "" {
+		alpn = "none"
+	}
+	fmt.Printf("  ALPN:     %s\n", alpn)
+	fmt.Printf("  Resumed:  %v\n", cs.DidResume)
+	if cs.ServerName != "" {
+		fmt.Printf("  SNI:      %s\n", cs.ServerName)
+	}
+	fmt.Printf("  OCSP:     %s\n", ocspStatus(cs))
+	if cs.Version < tls.VersionTLS12 {
+		warnings = append(warnings, tls.VersionName(cs.Version)+" is deprecated")
+	}
+
+	bold.Println("Certificates:")
+	now := time.Now()
+	for i, cert := range cs.PeerCertificates {
+		fmt.Printf("  [%d] %s\n", i, cert.Subject)
+		if s := sans(cert); s != "" {
+			fmt.Printf("      SANs:     %s\n", s)
+		}
+		fmt.Printf("      Issuer:   %s\n", cert.Issuer)
+		left := cert.NotAfter.Sub(now)
+		fmt.Printf("      Valid:    %s - %s (%d days left)\n", cert.NotBefore.Format("2006-01-02"), cert.NotAfter.Format("2006-01-02"), int(left.Hours()/24))
+		key, weak := keyInfo(cert)
+		fmt.Printf("      Key:      %s, %s\n", key, cert.SignatureAlgorithm)
+		fmt.Printf("      SHA-256:  %s\n", fingerprint(cert))
+		fmt.Printf("      SPKI:     %s\n", spkiPin(cert))
+
+		switch {
+		case now.After(cert.NotAfter):
+			warnings = append(warnings, fmt.Sprintf("[%d] expired on %s", i, cert.NotAfter.Format("2006-01-02")))
+		case now.Before(cert.NotBefore):
+			warnings = append(warnings, fmt.Sprintf("[%d] not valid before %s", i, cert.NotBefore.Format("2006-01-02")))
+		case left < expiryWarning:
+			warnings = append(warnings, fmt.Sprintf("[%d] expires in %d days", i, int(left.Hours()/24)))
+		}
+		if weak {
+			warnings = append(warnings, fmt.Sprintf("[%d] weak key %s", i, key))
+		}
+		switch cert.SignatureAlgorithm {
+		case x509.MD5WithRSA, x509.SHA1WithRSA, x509.ECDSAWithSHA1, x509.DSAWithSHA1:
+			if i < len(cs.PeerCertificates)-1 || cert.Subject.String() != cert.Issuer.String() {
+				warnings = append(warnings, fmt.Sprintf("[%d] weak signature %s", i, cert.SignatureAlgorithm))
+			}
+		}
+	}
+	if len(cs.PeerCertificates) > 0 {
+		name := host
+		if cs.ServerName != "" {
+			name = cs.ServerName
+		}
+		if err := cs.PeerCertificates[0].VerifyHostname(name); err != nil {
+			warnings = append(warnings, err.Error())
+		}
+	}
+
+	if len(warnings) > 0 {
+		bold.Println("Warnings:")
+		for _, w := range warnings {
+			warn.Printf("  ! %s\n", w)
+		}
+	}
+	fmt.Println("")
+}
+
+// unverifiedTLS handshakes with u again without verification after err
+// refused the certificates, so that printTLS shows the refused chain. The
+// certificates of err are used when u cannot be reached directly, eg
+// behind $proxy.
+func unverifiedTLS(client *http.Client, u *url.URL, err error) *tls.ConnectionState {
+	var verr *tls.CertificateVerificationError
+	if !errors.As(err, &verr) {
+		return nil
+	}
+	config := &tls.Config{}
+	if t, ok := client.Transport.(*http.Transport); ok && t.TLSClientConfig != nil {
+		config = t.TLSClientConfig.Clone()
+	}
+	config.InsecureSkipVerify, config.VerifyConnection = true, nil
+	if config.ServerName == "" {
+		config.ServerName = u.Hostname()
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	}
+	conn, e := tls.DialWithDialer(&net.Dialer{Timeout: 10 * time.Second}, "tcp", net.JoinHostPort(u.Hostname(), port), config)
+	if e != nil {
+		return &tls.ConnectionState{ServerName: config.ServerName, PeerCertificates: verr.UnverifiedCertificates}
+	}
+	defer conn.Close()
+	cs := conn.ConnectionState()
+	return &cs
+}
+
+func ocspStatus(cs *tls.ConnectionState) string {
+	if len(cs.OCSPResponse) == 0 {
+		return "not stapled"
+	}
+	var issuer *x509.Certificate
+	if len(cs.PeerCertificates) > 1 {
+		issuer = cs.PeerCertificates[1]
+	}
+	resp, err := ocsp.ParseResponse(cs.OCSPResponse, issuer)
+	if err != nil {
+		return "stapled, " + err.Error()
+	}
+	var status string
+	switch resp.Status {
+	case ocsp.Good:
+		status = "good"
+	case ocsp.Revoked:
+		status = "revoked at " + resp.RevokedAt.Format("2006-01-02")
+	default:
+		status = "unknown"
+	}
+	return fmt.Sprintf("stapled, %s, next update %s", status, resp.NextUpdate.Format("2006-01-02"))
+}
@@ -14,6 +14,8 @@ const (
 	Param
 	File
 	RawJSON
+	Assert
+	Capture
 )
 
 var EOF rune = scanner.EOF
@@ -28,12 +30,25 @@ type Tokenizer struct {
 	s      scanner.Scanner
 	tokBuf bytes.Buffer
 	err    string
+	// sep ends a value, it is EOF when each arg is a single token
+	sep  rune
+	args []string
 }
 
 func (t *Tokenizer) Init(str string) {
+	t.sep = ' '
+	t.args = nil
 	t.s.Init(strings.NewReader(str))
 }
 
+// InitArgs tokenizes command line arguments, values run to the end of
+// their argument so they may contain spaces
+func (t *Tokenizer) InitArgs(args []string) {
+	t.sep = scanner.EOF
+	t.args = args
+	t.s.Init(strings.NewReader(""))
+}
+
 func (t *Tokenizer) Next() Token {
 	t.tokBuf.Reset()
 
@@ -45,40 +60,70 @@ func (t *Tokenizer) Next() Token {
 		ch = t.s.Next()
 	}
 
+	// an argument is a token already, a JSON body in it keeps its spaces,
+	// quotes and colons
+	args := t.sep == scanner.EOF
+	if args && (ch == '[' || ch == '{' && t.s.Peek() != '{') {
+		t.tokBuf.WriteRune(ch)
+		return Token{Type: String, Val: t.scanNext(t.sep)}
+	}
+
 	for ch != scanner.EOF {
+		if args && (ch == ' ' || ch == '\'' || ch == '"') {
+			t.tokBuf.WriteRune(ch)
+			ch = t.s.Next()
+			continue
+		}
 		switch ch {
 		case ' ':
 			return Token{Type: String, Val: t.tokBuf.String()}
 		case '$':
 			t.tokBuf.WriteRune(ch)
 			t.scanNext('=')
-			return Token{Type: Variable, Key: t.Token(), Val: t.scanNext(' ')}
+			return Token{Type: Variable, Key: t.Token(), Val: t.scanNext(t.sep)}
 		case ':':
 			s := t.tokBuf.String()
 			if s == "http" || s == "https" || s == "" || strings.Contains(s, ".") {
 				t.tokBuf.WriteRune(ch)
-				return Token{Type: String, Val: t.scanNext(' ')}
+				return Token{Type: String, Val: t.scanNext(t.sep)}
 			}
-			return Token{Type: Header, Key: t.Token(), Val: t.scanNext(' ')}
+			return Token{Type: Header, Key: t.Token(), Val: t.scanNext(t.sep)}
 		case '=':
 			var token Token
 			ch = t.s.Next()
 			switch ch {
 			case '=':
-				token = Token{Type: Param, Key: t.Token(), Val: t.scanNext(' ')}
+				token = Token{Type: Param, Key: t.Token(), Val: t.scanNext(t.sep)}
 			case ':':
-				token = Token{Type: RawJSON, Key: t.Token(), Val: t.scanNext(' ')}
+				token = Token{Type: RawJSON, Key: t.Token(), Val: t.scanNext(t.sep)}
 			default:
 				token = Token{Type: Field, Key: t.Token()}
+				if ch == scanner.EOF {
+					return token
+				}
 				t.tokBuf.WriteRune(ch)
-				token.Val = t.scanNext(' ')
+				token.Val = t.scanNext(t.sep)
 			}
 
 			return token
+		case '<':
+			// name<=source, a field value may start with <
+			if t.tokBuf.Len() > 0 && t.s.Peek() == '=' {
+				t.s.Next()
+				return Token{Type: Capture, Key: t.Token(), Val: t.scanNext(t.sep)}
+			}
+			t.tokBuf.WriteRune(ch)
+			ch = t.s.Next()
 		case '@':
-			return Token{Type: File, Key: t.Token(), Val: t.scanNext(' ')}
+			return Token{Type: File, Key: t.Token(), Val: t.scanNext(t.sep)}
 		case '\'', '"':
 			return Token{Type: String, Val: t.scanNext(ch)}
+		case '?':
+			if t.tokBuf.Len() == 0 {
+				return Token{Type: Assert, Val: t.scanQuoted()}
+			}
+			t.tokBuf.WriteRune(ch)
+			ch = t.s.Next()
 		default:
 			t.tokBuf.WriteRune(ch)
 			ch = t.s.Next()
@@ -88,6 +133,11 @@ func (t *Tokenizer) Next() Token {
 	if t.tokBuf.Len() > 0 {
 		return Token{Type: String, Val: t.Token()}
 	}
+	if len(t.args) > 0 {
+		t.s.Init(strings.NewReader(t.args[0]))
+		t.args = t.args[1:]
+		return t.Next()
+	}
 	return Token{Type: EOF}
 }
 
@@ -106,6 +156,28 @@ func (t *Tokenizer) scanNext(c rune) string {
 	return t.tokBuf.String()
 }
 
+// scanQuoted scans to the next whitespace, quoted parts may contain spaces.
+// An argument is scanned to its end as is.
+func (t *Tokenizer) scanQuoted() string {
+	if t.sep == scanner.EOF {
+		return t.scanNext(t.sep)
+	}
+	var quote rune
+	for ch := t.s.Next(); ch != scanner.EOF; ch = t.s.Next() {
+		switch {
+		case quote == 0 && isWhitespace(ch):
+			return t.tokBuf.String()
+		case quote == 0 && (ch == '\'' || ch == '"'):
+			quote = ch
+		case ch == quote:
+			quote = 0
+		default:
+			t.tokBuf.WriteRune(ch)
+		}
+	}
+	return t.tokBuf.String()
+}
+
 func (t *Tokenizer) Token() string {
 	str := t.tokBuf.String()
 	t.tokBuf.Reset()
@@ -91,6 +91,65 @@ func TestFlag(t *testing.T) {
 	}
 }
 
+func TestCapture(t *testing.T) {
+	var tokenizer Tokenizer
+	tokenizer.Init(`env.token<=#data.token html=<b>`)
+
+	token := tokenizer.Next()
+	if token.Type != Capture {
+		t.Errorf("expected %v, actual %v", Capture, token.Type)
+	}
+	if token.Key != "env.token" || token.Val != "#data.token" {
+		t.Errorf("expected %s %s, actual %s %s", "env.token", "#data.token", token.Key, token.Val)
+	}
+
+	token = tokenizer.Next()
+	if token.Type != Field || token.Key != "html" || token.Val != "<b>" {
+		t.Errorf("expected %v %s %s, actual %v %s %s", Field, "html", "<b>", token.Type, token.Key, token.Val)
+	}
+}
+
+func TestAssert(t *testing.T) {
+	var tokenizer Tokenizer
+	tokenizer.Init(`?body*="hello world" ?status==200`)
+
+	token := tokenizer.Next()
+	if token.Type != Assert {
+		t.Errorf("expected %v, actual %v", Assert, token.Type)
+	}
+	if token.Val != "body*=hello world" {
+		t.Errorf("expected %s, actual %s", "body*=hello world", token.Val)
+	}
+	token = tokenizer.Next()
+	if token.Type != Assert || token.Val != "status==200" {
+		t.Errorf("expected %v %s, actual %v %s", Assert, "status==200", token.Type, token.Val)
+	}
+}
+
+func TestArgs(t *testing.T) {
+	var tokenizer Tokenizer
+	tokenizer.InitArgs([]string{"POST", ":8080/users", "name=John Smith", "age=:3", "Auth:token a", "empty=", `{"a": 1}`, "?body*=hello world", `?body*="x"`})
+
+	expected := []Token{
+		{Type: String, Val: "POST"},
+		{Type: String, Val: ":8080/users"},
+		{Type: Field, Key: "name", Val: "John Smith"},
+		{Type: RawJSON, Key: "age", Val: "3"},
+		{Type: Header, Key: "Auth", Val: "token a"},
+		{Type: Field, Key: "empty"},
+		{Type: String, Val: `{"a": 1}`},
+		{Type: Assert, Val: "body*=hello world"},
+		{Type: Assert, Val: `body*="x"`},
+		{Type: EOF},
+	}
+	for _, tt := range expected {
+		token := tokenizer.Next()
+		if token != tt {
+			t.Errorf("expected %v, actual %v", tt, token)
+		}
+	}
+}
+
 func TestInput(t *testing.T) {
 	var tokenizer Tokenizer
 	tokenizer.Init(`get http://baidu.com a:b c==d e=f g=:@/path/to/file h=:{"foo":"bar"} h=:["","",""] i@/path/to/j.txt $a=b`)
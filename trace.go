@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+var phaseNames = []string{"DNS lookup", "TCP connect", "TLS handshake", "Server wait", "Content transfer"}
+
+// Timing is the duration of each phase of a request, phases that did not
+// happen, such as DNS on a reused connection, are zero
+type Timing struct {
+	DNS        time.Duration `json:"dns"`
+	Connect    time.Duration `json:"connect"`
+	TLS        time.Duration `json:"tls"`
+	Wait       time.Duration `json:"wait"`
+	Transfer   time.Duration `json:"transfer"`
+	TTFB       time.Duration `json:"ttfb"`
+	Total      time.Duration `json:"total"`
+	RemoteAddr string        `json:"remote_addr,omitempty"`
+	Reused     bool          `json:"reused"`
+}
+
+func (t *Timing) phases() []time.Duration {
+	return []time.Duration{t.DNS, t.Connect, t.TLS, t.Wait, t.Transfer}
+}
+
+// tracer records the phase times of one request with httptrace
+type tracer struct {
+	mu                  sync.Mutex
+	start, done         time.Time
+	dnsStart, dnsDone   time.Time
+	connStart, connDone time.Time
+	tlsStart, tlsDone   time.Time
+	wrote, firstByte    time.Time
+	addr                string
+	reused              bool
+}
+
+func newTracer(ctx context.Context) (*tracer, context.Context) {
+	t := &tracer{start: time.Now()}
+	var now = func(p *time.Time) {
+		t.mu.Lock()
+		// keep the first, happy eyeballs may dial several addresses
+		if p.IsZero() {
+			*p = time.Now()
+		}
+		t.mu.Unlock()
+	}
+	return t, httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart:          func(httptrace.DNSStartInfo) { now(&t.dnsStart) },
+		DNSDone:           func(httptrace.DNSDoneInfo) { now(&t.dnsDone) },
+		ConnectStart:      func(string, string) { now(&t.connStart) },
+		ConnectDone:       func(string, string, error) { now(&t.connDone) },
+		TLSHandshakeStart: func() { now(&t.tlsStart) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { now(&t.tlsDone) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			t.addr = info.Conn.RemoteAddr().String()
+			t.reused = info.Reused
+			t.mu.Unlock()
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { now(&t.wrote) },
+		GotFirstResponseByte: func() { now(&t.firstByte) },
+	})
+}
+
+// finish marks the end of the response body
+func (t *tracer) finish() {
+	t.mu.Lock()
+	t.done = time.Now()
+	t.mu.Unlock()
+}
+
+func span(from, to time.Time) time.Duration {
+	if from.IsZero() || to.IsZero() || to.Before(from) {
+		return 0
+	}
+	return to.Sub(from)
+}
+
+func (t *tracer) timing() *Timing {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return &Timing{
+		DNS:        span(t.dnsStart, t.dnsDone),
+		Connect:    span(t.connStart, t.connDone),
+		TLS:        span(t.tlsStart, t.tlsDone),
+		Wait:       span(t.wrote, t.firstByte),
+		Transfer:   span(t.firstByte, t.done),
+		TTFB:       span(t.start, t.firstByte),
+		Total:      span(t.start, t.done),
+		RemoteAddr: t.addr,
+		Reused:     t.reused,
+	}
+}
+
+// waterfall prints every phase as a bar placed at its start
+func (t *tracer) waterfall() {
+	const width = 40
+	tm := t.timing()
+	t.mu.Lock()
+	starts := []time.Time{t.dnsStart, t.connStart, t.tlsStart, t.wrote, t.firstByte}
+	t.mu.Unlock()
+
+	conn := "new connection"
+	if tm.Reused {
+		conn = "reused connection"
+	}
+	color.New(color.Bold).Print("\nTiming:")
+	fmt.Printf(" %s, %s\n", tm.RemoteAddr, conn)
+	total := tm.Total
+	if total <= 0 {
+		total = 1
+	}
+	for i, d := range tm.phases() {
+		var bar string
+		if d > 0 {
+			offset := int(span(t.start, starts[i]) * width / total)
+			n := int(d * width / total)
+			if n == 0 {
+				n = 1
+			} else if n > width {
+				n = width
+			}
+			if offset+n > width {
+				offset = width - n
+			}
+			bar = strings.Repeat(" ", offset) + strings.Repeat("■", n)
+		}
+		text := "-"
+		if d > 0 {
+			text = round(d).String()
+		}
+		fmt.Printf("  %-17s %10s |%-40s|\n", phaseNames[i], text, bar)
+	}
+	fmt.Printf("  %-17s %10v\n", "Time to 1st byte", round(tm.TTFB))
+	fmt.Printf("  %-17s %10v\n", "Total", round(tm.Total))
+	fmt.Println("")
+}